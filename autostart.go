@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"deedles.dev/kawa/internal/desktop"
+	"deedles.dev/wlr"
+)
+
+const (
+	// autostartRestartDelay is how long to wait before restarting a
+	// program that has crashed. It is multiplied by the number of
+	// times in a row that the program has crashed.
+	autostartRestartDelay = time.Second
+
+	// autostartMaxRestarts is the number of times in a row that a
+	// program is restarted before giving up on it.
+	autostartMaxRestarts = 5
+
+	// autostartStableTime is how long a program has to run for
+	// before a crash is no longer considered to be part of a series.
+	autostartStableTime = 30 * time.Second
+)
+
+// AutostartCommand is a program that is started along with the
+// compositor.
+type AutostartCommand struct {
+	// Name identifies the program in the log.
+	Name string
+	Args []string
+
+	// Restart is whether or not the program should be restarted if
+	// it crashes.
+	Restart bool
+}
+
+func parseAutostartCommand(command string, restart bool) AutostartCommand {
+	args := strings.Fields(command)
+	return AutostartCommand{
+		Name:    filepath.Base(args[0]),
+		Args:    args,
+		Restart: restart,
+	}
+}
+
+// autostartProc tracks a running autostart program.
+type autostartProc struct {
+	AutostartCommand
+
+	pid     int
+	started time.Time
+	crashes int
+}
+
+// startAutostart starts the autostart commands from the config and,
+// if enabled, the XDG autostart entries. It should only be called
+// once the Wayland and X displays are available.
+func (server *Server) startAutostart() {
+	cmds := server.Autostart
+	if server.XDGAutostart {
+		cmds = append(cmds[:len(cmds):len(cmds)], xdgAutostartCommands()...)
+	}
+
+	for _, cmd := range cmds {
+		server.startAutostartProc(&autostartProc{AutostartCommand: cmd})
+	}
+}
+
+func (server *Server) startAutostartProc(p *autostartProc) {
+	stdout := autostartLogger{server: server, name: p.Name}
+	stderr := autostartLogger{server: server, name: p.Name}
+
+	cmd := exec.Command(p.Args[0], p.Args[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Start()
+	if err != nil {
+		wlr.Log(wlr.Error, "autostart %v: %v", p.Name, err)
+		return
+	}
+
+	p.pid = cmd.Process.Pid
+	p.started = time.Now()
+	server.autostartProcs[p.pid] = p
+	wlr.Log(wlr.Info, "autostart %v: started with PID %v", p.Name, p.pid)
+
+	go func() {
+		err := cmd.Wait()
+		stdout.flush()
+		stderr.flush()
+		server.post(func() { server.onAutostartExit(p, err) })
+	}()
+}
+
+func (server *Server) onAutostartExit(p *autostartProc, err error) {
+	delete(server.autostartProcs, p.pid)
+
+	if err == nil {
+		wlr.Log(wlr.Info, "autostart %v: exited", p.Name)
+		return
+	}
+	wlr.Log(wlr.Error, "autostart %v: %v", p.Name, err)
+
+	if !p.Restart || server.done || server.exiting {
+		return
+	}
+
+	if time.Since(p.started) >= autostartStableTime {
+		p.crashes = 0
+	}
+	p.crashes++
+	if p.crashes > autostartMaxRestarts {
+		wlr.Log(wlr.Error, "autostart %v: crashed %v times in a row, giving up", p.Name, autostartMaxRestarts)
+		return
+	}
+
+	server.after(time.Duration(p.crashes)*autostartRestartDelay, func() {
+		if server.done || server.exiting {
+			return
+		}
+		server.startAutostartProc(p)
+	})
+}
+
+// autostartLogger logs the output of an autostart program line by
+// line.
+type autostartLogger struct {
+	server *Server
+	name   string
+
+	m   sync.Mutex
+	buf []byte
+}
+
+func (w *autostartLogger) Write(data []byte) (int, error) {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	w.buf = append(w.buf, data...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.log(string(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+	}
+	return len(data), nil
+}
+
+func (w *autostartLogger) flush() {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	if len(w.buf) != 0 {
+		w.log(string(w.buf))
+		w.buf = nil
+	}
+}
+
+func (w *autostartLogger) log(line string) {
+	// Output is read on other goroutines but wlroots should only be
+	// called from the main one.
+	w.server.post(func() { wlr.Log(wlr.Info, "%v: %v", w.name, line) })
+}
+
+// currentDesktops returns the desktop names that desktop entries are
+// checked against.
+func currentDesktops() []string {
+	desktops := []string{"kawa"}
+	if current := os.Getenv("XDG_CURRENT_DESKTOP"); current != "" {
+		desktops = append(desktops, strings.Split(current, ":")...)
+	}
+	return desktops
+}
+
+// xdgAutostartCommands returns the commands of the XDG autostart
+// entries that apply to kawa.
+func xdgAutostartCommands() []AutostartCommand {
+	desktops := currentDesktops()
+
+	var cmds []AutostartCommand
+	for _, path := range desktop.AutostartFiles() {
+		entry, err := desktop.ParseFile(path)
+		if err != nil {
+			wlr.Log(wlr.Error, "autostart: %v", err)
+			continue
+		}
+		if entry.Hidden || !entry.ShownIn(desktops) {
+			continue
+		}
+		if entry.TryExec != "" {
+			if _, err := exec.LookPath(entry.TryExec); err != nil {
+				continue
+			}
+		}
+
+		args, err := entry.Args()
+		if err != nil {
+			wlr.Log(wlr.Error, "autostart %v: %v", path, err)
+			continue
+		}
+
+		cmds = append(cmds, AutostartCommand{
+			Name: strings.TrimSuffix(filepath.Base(path), ".desktop"),
+			Args: args,
+		})
+	}
+	return cmds
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"deedles.dev/wlr"
+	"deedles.dev/wlr/xkb"
+	"deedles.dev/ximage/geom"
+)
+
+var (
+	DefaultBindings = []string{
+		"Logo+Return=new",
+		"Logo+r=resize",
+		"Logo+t=tile",
+		"Logo+f=fullscreen",
+		"Logo+m=move",
+		"Logo+q=close",
+		"Logo+h=hide",
+		"Logo+o=overview",
+		"Logo+x=menu",
+		"Logo+Escape=system-menu",
+		"Logo+space=layout-next",
+		"Logo+Shift+space=layout-prev",
+		"Logo+l=master-grow",
+		"Logo+k=master-shrink",
+		"Logo+equal=gap-grow",
+		"Logo+minus=gap-shrink",
+		"Logo+Tab=focus-next",
+		"Logo+Shift+Tab=focus-prev",
+		"Alt+Tab=switch",
+		"Alt+Shift+Tab=switch-prev",
+		"Logo+Left=focus-left",
+		"Logo+Right=focus-right",
+		"Logo+Up=focus-up",
+		"Logo+Down=focus-down",
+		"Logo+1=workspace-1",
+		"Logo+2=workspace-2",
+		"Logo+3=workspace-3",
+		"Logo+4=workspace-4",
+		"Logo+5=workspace-5",
+		"Logo+6=workspace-6",
+		"Logo+7=workspace-7",
+		"Logo+8=workspace-8",
+		"Logo+9=workspace-9",
+		"Logo+Ctrl+1=send-to-workspace-1",
+		"Logo+Ctrl+2=send-to-workspace-2",
+		"Logo+Ctrl+3=send-to-workspace-3",
+		"Logo+Ctrl+4=send-to-workspace-4",
+		"Logo+Ctrl+5=send-to-workspace-5",
+		"Logo+Ctrl+6=send-to-workspace-6",
+		"Logo+Ctrl+7=send-to-workspace-7",
+		"Logo+Ctrl+8=send-to-workspace-8",
+		"Logo+Ctrl+9=send-to-workspace-9",
+	}
+
+	modifierNames = map[string]wlr.KeyboardModifier{
+		"shift": wlr.KeyboardModifierShift,
+		"ctrl":  wlr.KeyboardModifierCtrl,
+		"alt":   wlr.KeyboardModifierAlt,
+		"mod1":  wlr.KeyboardModifierAlt,
+		"logo":  wlr.KeyboardModifierLogo,
+		"super": wlr.KeyboardModifierLogo,
+		"mod4":  wlr.KeyboardModifierLogo,
+	}
+
+	// ignoredModifiers are locking modifiers that shouldn't affect
+	// whether or not a binding matches.
+	ignoredModifiers = wlr.KeyboardModifierCaps | wlr.KeyboardModifierMod2
+)
+
+// Action is something that can be triggered by a keyboard shortcut.
+type Action func(*Server)
+
+var actions = map[string]Action{
+	"new":         (*Server).onMainMenuNew,
+	"resize":      (*Server).actionResize,
+	"tile":        (*Server).actionTile,
+	"fullscreen":  (*Server).actionFullscreen,
+	"move":        (*Server).actionMove,
+	"close":       (*Server).actionClose,
+	"hide":        (*Server).actionHide,
+	"overview":    (*Server).onMainMenuOverview,
+	"menu":        (*Server).actionMenu,
+	"system-menu": (*Server).actionSystemMenu,
+	"reload":      (*Server).onSystemMenuReload,
+	"blank":       (*Server).blankOutputs,
+	"logout":      (*Server).onSystemMenuLogOut,
+	"focus-next":  (*Server).actionFocusNext,
+	"focus-prev":  (*Server).actionFocusPrev,
+
+	"switch":      (*Server).actionSwitch,
+	"switch-prev": (*Server).actionSwitchPrev,
+	"focus-left":  (*Server).actionFocusLeft,
+	"focus-right": (*Server).actionFocusRight,
+	"focus-up":    (*Server).actionFocusUp,
+	"focus-down":  (*Server).actionFocusDown,
+
+	"layout-next":   (*Server).actionNextLayout,
+	"layout-prev":   (*Server).actionPrevLayout,
+	"master-grow":   (*Server).actionGrowMaster,
+	"master-shrink": (*Server).actionShrinkMaster,
+	"gap-grow":      (*Server).actionGrowGap,
+	"gap-shrink":    (*Server).actionShrinkGap,
+
+	"workspace-next":         (*Server).actionNextWorkspace,
+	"workspace-prev":         (*Server).actionPrevWorkspace,
+	"send-to-workspace-next": (*Server).actionSendToNextWorkspace,
+	"send-to-workspace-prev": (*Server).actionSendToPrevWorkspace,
+}
+
+// Binding maps a combination of modifiers and a key to an action.
+type Binding struct {
+	Mods   wlr.KeyboardModifier
+	Sym    xkb.KeySym
+	Action string
+}
+
+// parseBinding parses a Binding from a string of the form
+// "Mod+Mod+Key=action", such as "Logo+Shift+Return=new".
+func parseBinding(str string) (Binding, error) {
+	keys, action, ok := strings.Cut(str, "=")
+	if !ok {
+		return Binding{}, fmt.Errorf("binding %q has no action", str)
+	}
+	return newBinding(keys, strings.TrimSpace(action))
+}
+
+// newBinding creates a Binding that triggers action when the key
+// combination described by keys, such as "Logo+Shift+Return", is
+// pressed.
+func newBinding(keys, action string) (Binding, error) {
+	if _, ok := actions[action]; !ok {
+		return Binding{}, fmt.Errorf("unknown action %q", action)
+	}
+
+	b, err := parseKeys(keys)
+	if err != nil {
+		return Binding{}, err
+	}
+	b.Action = action
+	return b, nil
+}
+
+// parseKeys parses the key combination part of a binding. The
+// returned Binding has no action.
+func parseKeys(keys string) (Binding, error) {
+	parts := strings.Split(keys, "+")
+
+	var b Binding
+	for _, mod := range parts[:len(parts)-1] {
+		m, ok := modifierNames[strings.ToLower(strings.TrimSpace(mod))]
+		if !ok {
+			return Binding{}, fmt.Errorf("unknown modifier %q", mod)
+		}
+		b.Mods |= m
+	}
+
+	key := strings.TrimSpace(parts[len(parts)-1])
+	if key == "" {
+		return Binding{}, errors.New("binding has no key")
+	}
+	b.Sym = xkb.SymFromName(key, xkb.KeySymNoFlags)
+	if b.Sym == xkb.KeySymNoSymbol {
+		return Binding{}, fmt.Errorf("unknown key %q", key)
+	}
+	b.Sym = foldKeySym(b.Sym)
+
+	return b, nil
+}
+
+// parseBindings parses a list of bindings, returning the first error
+// encountered, if any.
+func parseBindings(strs []string) ([]Binding, error) {
+	bindings := make([]Binding, 0, len(strs))
+	for _, str := range strs {
+		b, err := parseBinding(str)
+		if err != nil {
+			return nil, err
+		}
+		bindings = append(bindings, b)
+	}
+	return bindings, nil
+}
+
+// foldKeySym maps uppercase Latin letters to their lowercase
+// equivalents, and Shift+Tab to Tab, so that bindings don't depend on
+// the state of Shift or Caps Lock.
+func foldKeySym(sym xkb.KeySym) xkb.KeySym {
+	if (sym >= 'A') && (sym <= 'Z') {
+		return sym + ('a' - 'A')
+	}
+	if sym == xkb.KeySymISO_Left_Tab {
+		return xkb.KeySymTab
+	}
+	return sym
+}
+
+func (server *Server) findBinding(mods wlr.KeyboardModifier, syms []xkb.KeySym) (Binding, bool) {
+	mods &^= ignoredModifiers
+
+	// Later bindings take priority so that the config file can
+	// override the defaults.
+	for _, b := range slices.Backward(server.Bindings) {
+		if b.Mods != mods {
+			continue
+		}
+		for _, sym := range syms {
+			if foldKeySym(sym) == b.Sym {
+				return b, true
+			}
+		}
+	}
+	return Binding{}, false
+}
+
+// withFocusedView calls f with the currently focused view. If there
+// isn't one, the user is asked to select one first, just like when
+// the action is chosen from the main menu.
+func (server *Server) withFocusedView(f func(*View)) {
+	view := server.focusedView()
+	if view == nil {
+		server.startSelectView(wlr.BtnRight, f)
+		return
+	}
+	f(view)
+}
+
+func (server *Server) actionResize() {
+	server.withFocusedView(func(view *View) {
+		server.startResize(view)
+	})
+}
+
+func (server *Server) actionTile() {
+	server.withFocusedView(func(view *View) {
+		server.toggleViewTiling(view)
+		server.startNormal()
+	})
+}
+
+func (server *Server) actionFullscreen() {
+	server.withFocusedView(func(view *View) {
+		server.toggleViewFullscreen(view)
+		server.startNormal()
+	})
+}
+
+func (server *Server) actionMove() {
+	server.withFocusedView(func(view *View) {
+		server.startMove(view)
+	})
+}
+
+func (server *Server) actionClose() {
+	server.withFocusedView(func(view *View) {
+		server.closeView(view)
+		server.startNormal()
+	})
+}
+
+func (server *Server) actionHide() {
+	server.withFocusedView(func(view *View) {
+		server.hideView(view)
+		server.startNormal()
+	})
+}
+
+func (server *Server) actionFocusNext() {
+	server.cycleFocus(1)
+}
+
+func (server *Server) actionFocusPrev() {
+	server.cycleFocus(-1)
+}
+
+// cycleFocus moves focus by dir through the mapped views in the order
+// that they were created.
+func (server *Server) cycleFocus(dir int) {
+	views := slices.Concat(server.tiled, server.views)
+	views = slices.DeleteFunc(views, func(view *View) bool { return !view.Mapped() })
+	if len(views) == 0 {
+		return
+	}
+	slices.SortFunc(views, func(v1, v2 *View) int { return cmp.Compare(v1.ID, v2.ID) })
+
+	i := slices.Index(views, server.focusedView())
+	if i < 0 {
+		i = 0
+		if dir > 0 {
+			i = -1
+		}
+	}
+	i = (i + dir + len(views)) % len(views)
+
+	server.focusView(views[i], views[i].Surface())
+}
+
+func (server *Server) actionMenu() {
+	server.startMenu(server.mainMenu, 0)
+}
+
+func (server *Server) actionSystemMenu() {
+	server.startMenu(server.systemMenu, 0)
+}
+
+func (server *Server) actionSwitch() {
+	server.startSwitcher(1)
+}
+
+func (server *Server) actionSwitchPrev() {
+	server.startSwitcher(-1)
+}
+
+// mruViews returns the mapped views on the current workspace, most
+// recently focused first.
+func (server *Server) mruViews() []*View {
+	views := slices.Concat(server.tiled, server.views)
+	views = slices.DeleteFunc(views, func(view *View) bool { return !view.Mapped() })
+	slices.SortStableFunc(views, func(v1, v2 *View) int { return cmp.Compare(v2.focusSerial, v1.focusSerial) })
+	return views
+}
+
+func (server *Server) actionFocusLeft() {
+	server.focusDirection(geom.Pt[float64](-1, 0))
+}
+
+func (server *Server) actionFocusRight() {
+	server.focusDirection(geom.Pt[float64](1, 0))
+}
+
+func (server *Server) actionFocusUp() {
+	server.focusDirection(geom.Pt[float64](0, -1))
+}
+
+func (server *Server) actionFocusDown() {
+	server.focusDirection(geom.Pt[float64](0, 1))
+}
+
+// focusDirection focuses the closest view in the direction of dir,
+// which must be a unit vector along one axis, from the focused view.
+// If no view is focused, the cursor is used as the starting point.
+func (server *Server) focusDirection(dir geom.Point[float64]) {
+	from := server.cursorCoords()
+	fv := server.focusedView()
+	if fv != nil {
+		from = fv.Bounds().Center()
+	}
+
+	var best *View
+	var bestScore float64
+	for _, view := range slices.Concat(server.tiled, server.views) {
+		if (view == fv) || !view.Mapped() {
+			continue
+		}
+
+		d := view.Bounds().Center().Sub(from)
+		along := d.X*dir.X + d.Y*dir.Y
+		across := math.Abs(d.X*dir.Y + d.Y*dir.X)
+		if along <= 0 {
+			continue
+		}
+
+		// Views that are off to the side are penalized so that the one
+		// most directly in line wins.
+		score := along + 2*across
+		if (best == nil) || (score < bestScore) {
+			best, bestScore = view, score
+		}
+	}
+
+	if best != nil {
+		server.focusView(best, best.Surface())
+	}
+}
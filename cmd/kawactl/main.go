@@ -0,0 +1,245 @@
+// kawactl controls a running instance of kawa via its control socket.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"deedles.dev/kawa/internal/ipc"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage: %v [options] <command> [arguments]
+
+Commands:
+  views                     list views
+  outputs                   list outputs
+  configure-output <output> <key=value...>
+                            change the mode, position, scale, transform or
+                            layout of an output, with the same options as
+                            the output directive in the config file
+  power <output> <state>    turn an output, or every output if it is *, on,
+                            off, or off-until-input
+  focus <view>              focus a view, unhiding it or switching to its
+                            workspace if necessary
+  move <view> <x> <y>       move a floating view
+  resize <view> <x> <y> <w> <h>
+                            move and resize a floating view
+  close <view>              ask a view to close
+  hide <view>               hide a view
+  unhide <view>             unhide a view
+  tile <view>               toggle whether a view is tiled
+  action <name>             run an action, such as new or logout
+  subscribe [event...]      print events as they happen, one JSON object
+                            per line, optionally limited to the given types
+
+Options:
+`, os.Args[0])
+	flag.PrintDefaults()
+}
+
+func parseRequest(args []string) (req ipc.Request, err error) {
+	req.Command = args[0]
+	args = args[1:]
+
+	if req.Command == ipc.CommandSubscribe {
+		req.Events = args
+		return req, nil
+	}
+
+	if req.Command == ipc.CommandPower {
+		if len(args) != 2 {
+			return req, fmt.Errorf("%v expects an output and a state", req.Command)
+		}
+		req.Output = args[0]
+		req.Power = args[1]
+		return req, nil
+	}
+
+	if req.Command == ipc.CommandConfigureOutput {
+		if len(args) < 2 {
+			return req, fmt.Errorf("%v expects an output and at least one option", req.Command)
+		}
+		req.Output = args[0]
+		req.Options = args[1:]
+		return req, nil
+	}
+
+	want := map[string]int{
+		ipc.CommandViews:   0,
+		ipc.CommandOutputs: 0,
+		ipc.CommandFocus:   1,
+		ipc.CommandMove:    3,
+		ipc.CommandResize:  5,
+		ipc.CommandClose:   1,
+		ipc.CommandHide:    1,
+		ipc.CommandUnhide:  1,
+		ipc.CommandTile:    1,
+		ipc.CommandAction:  1,
+	}
+	n, ok := want[req.Command]
+	if !ok {
+		return req, fmt.Errorf("unknown command %q", req.Command)
+	}
+	if len(args) != n {
+		return req, fmt.Errorf("%v expects %v arguments", req.Command, n)
+	}
+
+	if req.Command == ipc.CommandAction {
+		req.Action = args[0]
+		return req, nil
+	}
+
+	if n > 0 {
+		req.View, err = strconv.ParseUint(args[0], 10, 64)
+		if err != nil {
+			return req, fmt.Errorf("invalid view ID %q", args[0])
+		}
+	}
+
+	nums := make([]float64, len(args[min(n, 1):]))
+	for i, arg := range args[min(n, 1):] {
+		nums[i], err = strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return req, fmt.Errorf("invalid number %q", arg)
+		}
+	}
+	switch len(nums) {
+	case 4:
+		req.Bounds.Width, req.Bounds.Height = nums[2], nums[3]
+		fallthrough
+	case 2:
+		req.Bounds.X, req.Bounds.Y = nums[0], nums[1]
+	}
+
+	return req, nil
+}
+
+func printViews(views []ipc.View) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "ID\tPID\tWS\tSTATE\tBOUNDS\tTITLE")
+	for _, view := range views {
+		state := "floating"
+		switch {
+		case view.Hidden:
+			state = "hidden"
+		case view.Fullscreen:
+			state = "fullscreen"
+		case view.Tiled:
+			state = "tiled"
+		}
+		if view.Focused {
+			state += ",focused"
+		}
+
+		ws := "-"
+		if view.Workspace != 0 {
+			ws = strconv.Itoa(view.Workspace)
+		}
+
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\n", view.ID, view.PID, ws, state, formatRect(view.Bounds), view.Title)
+	}
+}
+
+func printOutputs(outputs []ipc.Output) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "NAME\tPOWER\tSCALE\tBOUNDS")
+	for _, out := range outputs {
+		power := "off"
+		if out.On {
+			power = "on"
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", out.Name, power, out.Scale, formatRect(out.Bounds))
+	}
+}
+
+func subscribe(client *ipc.Client, events []string) error {
+	err := client.Subscribe(events...)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	for {
+		ev, err := client.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		err = enc.Encode(ev)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func formatRect(r ipc.Rect) string {
+	return fmt.Sprintf("%vx%v+%v+%v", r.Width, r.Height, r.X, r.Y)
+}
+
+func main() {
+	socket := flag.String("socket", "", "path to the control socket (default $"+ipc.SocketEnv+")")
+	jsonOutput := flag.Bool("json", false, "print responses as JSON")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	req, err := parseRequest(flag.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+
+	client, err := ipc.Dial(*socket)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "connect: %v\n", err)
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	if req.Command == ipc.CommandSubscribe {
+		err := subscribe(client, req.Events)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: %v\n", req.Command, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	rsp, err := client.Do(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v: %v\n", req.Command, err)
+		os.Exit(1)
+	}
+
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		enc.Encode(rsp)
+		return
+	}
+
+	switch req.Command {
+	case ipc.CommandViews:
+		printViews(rsp.Views)
+	case ipc.CommandOutputs, ipc.CommandConfigureOutput, ipc.CommandPower:
+		printOutputs(rsp.Outputs)
+	}
+}
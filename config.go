@@ -0,0 +1,485 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"deedles.dev/wlr"
+)
+
+var (
+	DefaultTerms = []string{"sakura", "alacritty"}
+
+	// colorNames maps the names used in the config file to the colors
+	// that they set.
+	colorNames = map[string]*color.NRGBA{
+		"background":           &ColorBackground,
+		"selection-box":        &ColorSelectionBox,
+		"selection-background": &ColorSelectionBackground,
+		"active-border":        &ColorActiveBorder,
+		"inactive-border":      &ColorInactiveBorder,
+		"menu-selected":        &ColorMenuSelected,
+		"menu-unselected":      &ColorMenuUnselected,
+		"menu-border":          &ColorMenuBorder,
+		"surface":              &ColorSurface,
+	}
+
+	// defaultColors holds the original values of the colors in
+	// colorNames so that they can be restored if a color is removed
+	// from the config file.
+	defaultColors = func() map[string]color.NRGBA {
+		colors := make(map[string]color.NRGBA, len(colorNames))
+		for name, c := range colorNames {
+			colors[name] = *c
+		}
+		return colors
+	}()
+)
+
+// Config is the full set of user-configurable settings.
+type Config struct {
+	Terms     []string
+	BG        string
+	BGScale   string
+	Outputs   []OutputConfig
+	Colors    map[string]color.NRGBA
+	Border    float64
+	Bindings  []Binding
+	Autostart []AutostartCommand
+	Menus     []MenuCommand
+
+	XDGAutostart bool
+
+	ExitTimeout time.Duration
+	IdleTimeout time.Duration
+
+	Layout      string
+	MasterRatio float64
+	TileGap     float64
+}
+
+// DefaultConfig returns the configuration that is used when no config
+// file exists.
+func DefaultConfig() *Config {
+	bindings, err := parseBindings(DefaultBindings)
+	if err != nil {
+		panic(fmt.Errorf("parse default bindings: %w", err))
+	}
+
+	return &Config{
+		Terms:    DefaultTerms,
+		BGScale:  "stretch",
+		Colors:   make(map[string]color.NRGBA),
+		Border:   DefaultWindowBorder,
+		Bindings: bindings,
+
+		ExitTimeout: DefaultExitTimeout,
+
+		Layout:      DefaultLayout,
+		MasterRatio: DefaultMasterRatio,
+		TileGap:     DefaultTileGap,
+	}
+}
+
+// defaultConfigPath returns the path of the config file that is used
+// if none is specified.
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "kawa", "config")
+}
+
+// LoadConfig reads the config file at path. If the file doesn't
+// exist, the default configuration is returned.
+func LoadConfig(path string) (*Config, error) {
+	if path == "" {
+		return DefaultConfig(), nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return DefaultConfig(), nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	config, err := ParseConfig(file)
+	if err != nil {
+		return nil, fmt.Errorf("%v:%w", path, err)
+	}
+	return config, nil
+}
+
+// ConfigError is an error in a config file.
+type ConfigError struct {
+	Line int
+	Err  error
+}
+
+func (err *ConfigError) Error() string {
+	return fmt.Sprintf("%v: %v", err.Line, err.Err)
+}
+
+func (err *ConfigError) Unwrap() error {
+	return err.Err
+}
+
+// ParseConfig parses a config file. Each line of the file consists of
+// a directive followed by its arguments, separated by whitespace.
+// Empty lines and lines starting with # are ignored.
+func ParseConfig(r io.Reader) (*Config, error) {
+	config := DefaultConfig()
+
+	var terms []string
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		fields := strings.Fields(s.Text())
+		if (len(fields) == 0) || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		err := config.parseDirective(fields[0], fields[1:], &terms)
+		if err != nil {
+			return nil, &ConfigError{Line: line, Err: err}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	if terms != nil {
+		config.Terms = terms
+	}
+
+	return config, nil
+}
+
+func (config *Config) parseDirective(name string, args []string, terms *[]string) error {
+	switch name {
+	case "term":
+		if len(args) == 0 {
+			return errors.New("term requires a command")
+		}
+		*terms = append(*terms, strings.Join(args, " "))
+
+	case "bg":
+		if len(args) == 0 {
+			return errors.New("bg requires a path")
+		}
+		config.BG = strings.Join(args, " ")
+
+	case "bgscale":
+		if len(args) != 1 {
+			return errors.New("bgscale requires exactly one argument")
+		}
+		if _, ok := scaleFuncs[args[0]]; !ok {
+			return fmt.Errorf("unknown scaling method %q", args[0])
+		}
+		config.BGScale = args[0]
+
+	case "output":
+		c, err := parseOutputDirective(args)
+		if err != nil {
+			return err
+		}
+		config.Outputs = append(config.Outputs, c)
+
+	case "color":
+		if len(args) != 2 {
+			return errors.New("color requires a name and a value")
+		}
+		if _, ok := colorNames[args[0]]; !ok {
+			return fmt.Errorf("unknown color %q", args[0])
+		}
+		c, err := parseColor(args[1])
+		if err != nil {
+			return err
+		}
+		config.Colors[args[0]] = c
+
+	case "border":
+		if len(args) != 1 {
+			return errors.New("border requires exactly one argument")
+		}
+		border, err := strconv.ParseFloat(args[0], 64)
+		if err != nil {
+			return fmt.Errorf("invalid border width %q", args[0])
+		}
+		if border < 0 {
+			return errors.New("border width must not be negative")
+		}
+		config.Border = border
+
+	case "bind":
+		if len(args) != 2 {
+			return errors.New("bind requires a key combination and an action")
+		}
+		b, err := newBinding(args[0], args[1])
+		if err != nil {
+			return err
+		}
+		config.Bindings = append(config.Bindings, b)
+
+	case "unbind":
+		if len(args) != 1 {
+			return errors.New("unbind requires a key combination")
+		}
+		b, err := parseKeys(args[0])
+		if err != nil {
+			return err
+		}
+		config.Bindings = slices.DeleteFunc(config.Bindings, func(c Binding) bool {
+			return (c.Mods == b.Mods) && (c.Sym == b.Sym)
+		})
+
+	case "autostart", "autorestart":
+		if len(args) == 0 {
+			return fmt.Errorf("%v requires a command", name)
+		}
+		cmd := parseAutostartCommand(strings.Join(args, " "), name == "autorestart")
+		config.Autostart = append(config.Autostart, cmd)
+
+	case "menu", "sweepmenu":
+		cmd, err := parseMenuCommand(args, name == "sweepmenu")
+		if err != nil {
+			return err
+		}
+		config.Menus = append(config.Menus, cmd)
+
+	case "xdgautostart":
+		if len(args) != 1 {
+			return errors.New("xdgautostart requires exactly one argument")
+		}
+		enable, err := strconv.ParseBool(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", args[0])
+		}
+		config.XDGAutostart = enable
+
+	case "exittimeout":
+		if len(args) != 1 {
+			return errors.New("exittimeout requires exactly one argument")
+		}
+		timeout, err := time.ParseDuration(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", args[0])
+		}
+		if timeout < 0 {
+			return errors.New("exittimeout must not be negative")
+		}
+		config.ExitTimeout = timeout
+
+	case "idletimeout":
+		if len(args) != 1 {
+			return errors.New("idletimeout requires exactly one argument")
+		}
+		timeout, err := time.ParseDuration(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", args[0])
+		}
+		if timeout < 0 {
+			return errors.New("idletimeout must not be negative")
+		}
+		config.IdleTimeout = timeout
+
+	case "layout":
+		if len(args) != 1 {
+			return errors.New("layout requires exactly one argument")
+		}
+		if layoutByName(args[0]) == nil {
+			return fmt.Errorf("unknown layout %q", args[0])
+		}
+		config.Layout = args[0]
+
+	case "masterratio":
+		if len(args) != 1 {
+			return errors.New("masterratio requires exactly one argument")
+		}
+		ratio, err := strconv.ParseFloat(args[0], 64)
+		if err != nil {
+			return fmt.Errorf("invalid ratio %q", args[0])
+		}
+		if (ratio < MinMasterRatio) || (ratio > MaxMasterRatio) {
+			return fmt.Errorf("masterratio must be between %v and %v", MinMasterRatio, MaxMasterRatio)
+		}
+		config.MasterRatio = ratio
+
+	case "gap":
+		if len(args) != 1 {
+			return errors.New("gap requires exactly one argument")
+		}
+		gap, err := strconv.ParseFloat(args[0], 64)
+		if err != nil {
+			return fmt.Errorf("invalid gap %q", args[0])
+		}
+		if gap < 0 {
+			return errors.New("gap must not be negative")
+		}
+		config.TileGap = gap
+
+	default:
+		return fmt.Errorf("unknown directive %q", name)
+	}
+
+	return nil
+}
+
+// parseOutputDirective parses the arguments of an output directive,
+// which are the name of the output followed by any number of
+// key=value pairs.
+func parseOutputDirective(args []string) (OutputConfig, error) {
+	if len(args) == 0 {
+		return OutputConfig{}, errors.New("output requires a name")
+	}
+
+	c := OutputConfig{Name: args[0], X: -1, Y: -1}
+	err := parseOutputOptions(&c, args[1:])
+	if err != nil {
+		return OutputConfig{}, err
+	}
+	return c, nil
+}
+
+// parseOutputOptions sets the fields of c given by options, which are
+// key=value pairs as used by the output directive.
+func parseOutputOptions(c *OutputConfig, options []string) error {
+	for _, arg := range options {
+		key, val, ok := strings.Cut(arg, "=")
+		if !ok {
+			return fmt.Errorf("output option %q is not of the form key=value", arg)
+		}
+
+		var err error
+		switch key {
+		case "x":
+			c.X, err = strconv.Atoi(val)
+		case "y":
+			c.Y, err = strconv.Atoi(val)
+		case "mode":
+			w, h, ok := strings.Cut(val, "x")
+			if !ok {
+				return fmt.Errorf("invalid mode %q", val)
+			}
+			c.Width, err = strconv.Atoi(w)
+			if err == nil {
+				c.Height, err = strconv.Atoi(h)
+			}
+		case "scale":
+			var scale float64
+			scale, err = strconv.ParseFloat(val, 32)
+			c.Scale = float32(scale)
+		case "transform":
+			c.Transform, err = parseTransform(val)
+		case "layout":
+			if layoutByName(val) == nil {
+				err = errors.New("unknown layout")
+			}
+			c.Layout = val
+		default:
+			return fmt.Errorf("unknown output option %q", key)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid output option %q: %w", arg, err)
+		}
+	}
+
+	return nil
+}
+
+// parseColor parses a color of the form #RRGGBB or #RRGGBBAA.
+func parseColor(str string) (color.NRGBA, error) {
+	hex, ok := strings.CutPrefix(str, "#")
+	if !ok || ((len(hex) != 6) && (len(hex) != 8)) {
+		return color.NRGBA{}, fmt.Errorf("invalid color %q", str)
+	}
+	if len(hex) == 6 {
+		hex += "FF"
+	}
+
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("invalid color %q", str)
+	}
+
+	return color.NRGBA{
+		R: uint8(v >> 24),
+		G: uint8(v >> 16),
+		B: uint8(v >> 8),
+		A: uint8(v),
+	}, nil
+}
+
+// applyStyle sets the global style variables from the config.
+func (config *Config) applyStyle() {
+	for name, p := range colorNames {
+		c, ok := config.Colors[name]
+		if !ok {
+			c = defaultColors[name]
+		}
+		*p = c
+	}
+	WindowBorder = config.Border
+}
+
+// setConfig sets the parts of the server's state that come from
+// config and don't require the server to be initialized.
+func (server *Server) setConfig(config *Config) {
+	server.Terms = config.Terms
+	server.OutputConfigs = config.Outputs
+	server.Bindings = config.Bindings
+	server.Autostart = config.Autostart
+	server.XDGAutostart = config.XDGAutostart
+	server.MenuCommands = config.Menus
+	server.ExitTimeout = config.ExitTimeout
+	server.IdleTimeout = config.IdleTimeout
+	server.Layout = config.Layout
+	server.MasterRatio = config.MasterRatio
+	server.TileGap = config.TileGap
+	config.applyStyle()
+}
+
+// reloadConfig reloads the configuration and applies it to the
+// running server. If the configuration can't be loaded, the current
+// one is kept and the error is shown in the status bar.
+func (server *Server) reloadConfig() {
+	config, err := server.LoadConfig()
+	if err != nil {
+		wlr.Log(wlr.Error, "reload config: %v", err)
+		server.showMessage(fmt.Sprintf("reload config: %v", err))
+		return
+	}
+
+	server.setConfig(config)
+	server.setBG(config.BG, config.BGScale)
+
+	for _, out := range server.outputs {
+		server.reconfigureOutput(out, server.outputConfig(out))
+	}
+	server.resetIdle()
+	server.apps = desktopApps()
+
+	// An open menu would otherwise be left holding released textures.
+	if _, ok := server.inputMode.(*inputModeMenu); ok {
+		server.startNormal()
+	}
+	server.releaseUI()
+	server.initUI()
+	server.updateTitles()
+
+	wlr.Log(wlr.Info, "reloaded config")
+	server.showMessage("")
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"time"
+
+	"deedles.dev/wlr"
+)
+
+// resetIdle records input activity. It turns the outputs back on if
+// they were turned off for being idle, or if they were turned off
+// until the next input, and makes sure that the idle timer is running.
+//
+// TODO: Expose ext-idle-notify-v1 and zwp_idle_inhibit_manager_v1 once
+// deedles.dev/wlr has bindings for them.
+func (server *Server) resetIdle() {
+	server.lastInput = time.Now()
+	server.wakeOutputs()
+
+	if (server.IdleTimeout > 0) && (server.idleTimer == nil) {
+		server.idleTimer = server.after(server.IdleTimeout, server.onIdleTimer)
+	}
+}
+
+func (server *Server) onIdleTimer() {
+	server.idleTimer = nil
+	if (server.IdleTimeout <= 0) || server.idle {
+		return
+	}
+
+	// Resetting the timer on every input event would be wasteful, so
+	// it just waits again for however much longer is left.
+	remaining := server.IdleTimeout - time.Since(server.lastInput)
+	if remaining > 0 {
+		server.idleTimer = server.after(remaining, server.onIdleTimer)
+		return
+	}
+
+	server.blankOutputs()
+}
+
+// blankOutputs turns off all of the outputs until the next input
+// event.
+func (server *Server) blankOutputs() {
+	if server.idle {
+		return
+	}
+	server.idle = true
+
+	for _, out := range server.outputs {
+		if out.poweredOff {
+			continue
+		}
+		out.Output.Enable(false)
+		out.Output.Commit()
+	}
+	wlr.Log(wlr.Info, "idle: turned outputs off")
+}
+
+// wakeOutputs turns on the outputs that are off until the next input
+// event. This is called for every input event, so it does nothing if
+// there aren't any.
+func (server *Server) wakeOutputs() {
+	idle := server.idle
+	server.idle = false
+
+	var woken int
+	for _, out := range server.outputs {
+		switch {
+		case out.poweredOff && out.wakeOnInput:
+			out.poweredOff, out.wakeOnInput = false, false
+		case out.poweredOff, !idle:
+			continue
+		}
+
+		out.Output.Enable(true)
+		out.Output.Commit()
+		woken++
+	}
+	if woken != 0 {
+		wlr.Log(wlr.Info, "idle: turned %v outputs on", woken)
+	}
+}
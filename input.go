@@ -25,6 +25,17 @@ type CursorRequester interface {
 	RequestCursor(*Server, wlr.Surface, int, int)
 }
 
+// KeyPresser is implemented by input modes that want to handle key
+// presses before keyboard shortcuts are checked. If KeyPressed
+// returns true, the key press is not processed any further.
+type KeyPresser interface {
+	KeyPressed(*Server, []xkb.KeySym, time.Time) bool
+}
+
+type ModifiersChanger interface {
+	ModifiersChanged(*Server, wlr.KeyboardModifier)
+}
+
 type Keyboard struct {
 	Device wlr.Keyboard
 
@@ -44,11 +55,19 @@ func (server *Server) onNewInput(device wlr.InputDevice) {
 func (server *Server) onKeyboardModifiers(kb *Keyboard) {
 	server.seat.SetKeyboard(kb.Device)
 	server.seat.KeyboardNotifyModifiers(kb.Device.Modifiers())
+
+	m, ok := server.inputMode.(ModifiersChanger)
+	if ok {
+		m.ModifiersChanged(server, kb.Device.GetModifiers())
+	}
 }
 
 func (server *Server) onKeyboardKey(kb *Keyboard, code uint32, update bool, state wlr.KeyState, t time.Time) {
 	switch state {
 	case wlr.KeyStatePressed:
+		// Releases aren't counted so that the release of the key that
+		// blanked the outputs doesn't immediately wake them again.
+		server.resetIdle()
 		server.onKeyboardKeyPressed(kb, code, update, t)
 	case wlr.KeyStateReleased:
 		server.onKeyboardKeyReleased(kb, code, update, t)
@@ -56,6 +75,11 @@ func (server *Server) onKeyboardKey(kb *Keyboard, code uint32, update bool, stat
 }
 
 func (server *Server) onKeyboardKeyPressed(kb *Keyboard, code uint32, update bool, t time.Time) {
+	m, ok := server.inputMode.(KeyPresser)
+	if ok && m.KeyPressed(server, keySyms(kb, code), t) {
+		return
+	}
+
 	if server.handleKeyboardShortcut(kb, code, t) {
 		return
 	}
@@ -70,6 +94,7 @@ func (server *Server) onKeyboardKeyReleased(kb *Keyboard, code uint32, update bo
 }
 
 func (server *Server) onCursorMotion(dev wlr.Pointer, t time.Time, dx, dy float64) {
+	server.resetIdle()
 	server.cursor.Move(dev.Base(), dx, dy)
 
 	m, ok := server.inputMode.(CursorMover)
@@ -79,6 +104,7 @@ func (server *Server) onCursorMotion(dev wlr.Pointer, t time.Time, dx, dy float6
 }
 
 func (server *Server) onCursorMotionAbsolute(dev wlr.Pointer, t time.Time, x, y float64) {
+	server.resetIdle()
 	server.cursor.WarpAbsolute(dev.Base(), x, y)
 
 	m, ok := server.inputMode.(CursorMover)
@@ -88,6 +114,8 @@ func (server *Server) onCursorMotionAbsolute(dev wlr.Pointer, t time.Time, x, y
 }
 
 func (server *Server) onCursorButton(dev wlr.Pointer, t time.Time, b wlr.CursorButton, state wlr.ButtonState) {
+	server.resetIdle()
+
 	switch state {
 	case wlr.ButtonPressed:
 		m, ok := server.inputMode.(CursorButtonPresser)
@@ -103,6 +131,7 @@ func (server *Server) onCursorButton(dev wlr.Pointer, t time.Time, b wlr.CursorB
 }
 
 func (server *Server) onCursorAxis(dev wlr.Pointer, t time.Time, source wlr.AxisSource, orient wlr.AxisOrientation, delta float64, deltaDiscrete int32) {
+	server.resetIdle()
 	server.seat.PointerNotifyAxis(t, orient, delta, deltaDiscrete, source)
 }
 
@@ -177,9 +206,34 @@ func (server *Server) setCursor(name string) {
 	server.cursor.SetXCursor(server.cursorMgr, name)
 }
 
+// keySymRune returns the character that sym types, if any. The
+// printable Latin-1 keysyms have the same values as their code points
+// and the rest of Unicode is offset by 0x1000000.
+func keySymRune(sym xkb.KeySym) (rune, bool) {
+	switch {
+	case (sym >= 0x20) && (sym <= 0x7E), (sym >= 0xA0) && (sym <= 0xFF):
+		return rune(sym), true
+	case (sym >= 0x1000100) && (sym <= 0x110FFFF):
+		return rune(sym - 0x1000000), true
+	}
+	return 0, false
+}
+
+// keySyms returns the symbols produced by the key with the evdev
+// keycode code in the keyboard's current state.
+func keySyms(kb *Keyboard, code uint32) []xkb.KeySym {
+	// xkbcommon keycodes are offset from evdev ones by 8.
+	return kb.Device.XKBState().Syms(xkb.KeyCode(code + 8))
+}
+
 func (server *Server) handleKeyboardShortcut(kb *Keyboard, code uint32, t time.Time) bool {
-	// TODO
-	return false
+	b, ok := server.findBinding(kb.Device.GetModifiers(), keySyms(kb, code))
+	if !ok {
+		return false
+	}
+
+	actions[b.Action](server)
+	return true
 }
 
 func (server *Server) cursorCoords() geom.Point[float64] {
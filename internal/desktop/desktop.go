@@ -0,0 +1,309 @@
+// Package desktop implements the parts of the freedesktop.org desktop
+// entry and autostart specifications that kawa needs.
+package desktop
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Entry is a parsed desktop entry. Only the keys that are needed to
+// launch the entry are kept, and localized values are ignored.
+type Entry struct {
+	Type       string
+	Name       string
+	Exec       string
+	TryExec    string
+	Hidden     bool
+	NoDisplay  bool
+	Terminal   bool
+	OnlyShowIn []string
+	NotShowIn  []string
+}
+
+// Parse parses the [Desktop Entry] group of a desktop entry file.
+// Other groups are skipped.
+func Parse(r io.Reader) (*Entry, error) {
+	var entry Entry
+	var group string
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimSpace(s.Text())
+		if (text == "") || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(text, "[") {
+			if !strings.HasSuffix(text, "]") {
+				return nil, fmt.Errorf("%v: malformed group header", line)
+			}
+			group = text[1 : len(text)-1]
+			continue
+		}
+		if group != "Desktop Entry" {
+			continue
+		}
+
+		key, val, ok := strings.Cut(text, "=")
+		if !ok {
+			return nil, fmt.Errorf("%v: expected key=value", line)
+		}
+		key = strings.TrimSpace(key)
+		val = unescape(strings.TrimSpace(val))
+
+		var err error
+		switch key {
+		case "Type":
+			entry.Type = val
+		case "Name":
+			entry.Name = val
+		case "Exec":
+			entry.Exec = val
+		case "TryExec":
+			entry.TryExec = val
+		case "Hidden":
+			entry.Hidden, err = parseBool(val)
+		case "NoDisplay":
+			entry.NoDisplay, err = parseBool(val)
+		case "Terminal":
+			entry.Terminal, err = parseBool(val)
+		case "OnlyShowIn":
+			entry.OnlyShowIn = parseList(val)
+		case "NotShowIn":
+			entry.NotShowIn = parseList(val)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v: %w", line, key, err)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	if group == "" {
+		return nil, errors.New("no [Desktop Entry] group")
+	}
+
+	return &entry, nil
+}
+
+// ParseFile parses the desktop entry at path.
+func ParseFile(path string) (*Entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entry, err := Parse(file)
+	if err != nil {
+		return nil, fmt.Errorf("%v:%w", path, err)
+	}
+	return entry, nil
+}
+
+// ShownIn reports whether the entry should be shown in a session
+// running any of the given desktops, according to its OnlyShowIn and
+// NotShowIn keys.
+func (entry *Entry) ShownIn(desktops []string) bool {
+	for _, d := range desktops {
+		if slices.Contains(entry.NotShowIn, d) {
+			return false
+		}
+	}
+
+	if entry.OnlyShowIn == nil {
+		return true
+	}
+	for _, d := range desktops {
+		if slices.Contains(entry.OnlyShowIn, d) {
+			return true
+		}
+	}
+	return false
+}
+
+// Args splits the entry's Exec key into arguments. Field codes are
+// removed, as kawa never has any files or URLs to pass to a program.
+func (entry *Entry) Args() ([]string, error) {
+	if entry.Exec == "" {
+		return nil, errors.New("no Exec key")
+	}
+
+	var args []string
+	var arg strings.Builder
+	var inArg, quoted bool
+	for i := 0; i < len(entry.Exec); i++ {
+		c := entry.Exec[i]
+		switch {
+		case quoted && (c == '"'):
+			quoted = false
+
+		case quoted && (c == '\\') && (i+1 < len(entry.Exec)):
+			i++
+			arg.WriteByte(entry.Exec[i])
+
+		case quoted:
+			arg.WriteByte(c)
+
+		case c == '"':
+			quoted = true
+			inArg = true
+
+		case (c == ' ') || (c == '\t'):
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+
+		case (c == '%') && (i+1 < len(entry.Exec)):
+			i++
+			if entry.Exec[i] == '%' {
+				arg.WriteByte('%')
+				inArg = true
+			}
+
+		default:
+			arg.WriteByte(c)
+			inArg = true
+		}
+	}
+	if quoted {
+		return nil, errors.New("unterminated quote in Exec key")
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+
+	if len(args) == 0 {
+		return nil, errors.New("empty Exec key")
+	}
+	return args, nil
+}
+
+// AutostartFiles returns the paths of the autostart entries in the
+// XDG config directories. An entry in a more important directory
+// hides any entry with the same file name in a less important one.
+func AutostartFiles() []string {
+	dirs := []string{configHome()}
+	configDirs := os.Getenv("XDG_CONFIG_DIRS")
+	if configDirs == "" {
+		configDirs = "/etc/xdg"
+	}
+	dirs = append(dirs, filepath.SplitList(configDirs)...)
+
+	seen := make(map[string]struct{})
+	var files []string
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+
+		matches, _ := filepath.Glob(filepath.Join(dir, "autostart", "*.desktop"))
+		for _, path := range matches {
+			name := filepath.Base(path)
+			if _, ok := seen[name]; ok {
+				continue
+			}
+			seen[name] = struct{}{}
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+// ApplicationFiles returns the paths of the application entries in
+// the XDG data directories. As with AutostartFiles, an entry in a more
+// important directory hides any entry with the same desktop file ID,
+// which is its path relative to the applications directory with
+// slashes replaced by dashes, in a less important one.
+func ApplicationFiles() []string {
+	dirs := []string{dataHome()}
+	dataDirs := os.Getenv("XDG_DATA_DIRS")
+	if dataDirs == "" {
+		dataDirs = "/usr/local/share:/usr/share"
+	}
+	dirs = append(dirs, filepath.SplitList(dataDirs)...)
+
+	seen := make(map[string]struct{})
+	var files []string
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+
+		root := filepath.Join(dir, "applications")
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if (err != nil) || d.IsDir() || (filepath.Ext(path) != ".desktop") {
+				return nil
+			}
+
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return nil
+			}
+			id := strings.ReplaceAll(filepath.ToSlash(rel), "/", "-")
+			if _, ok := seen[id]; ok {
+				return nil
+			}
+			seen[id] = struct{}{}
+			files = append(files, path)
+			return nil
+		})
+	}
+	return files
+}
+
+func dataHome() string {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return dir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".local", "share")
+}
+
+func configHome() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return dir
+}
+
+func parseBool(val string) (bool, error) {
+	switch val {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	default:
+		return false, fmt.Errorf("invalid boolean %q", val)
+	}
+}
+
+func parseList(val string) []string {
+	list := strings.Split(val, ";")
+	return slices.DeleteFunc(list, func(v string) bool { return v == "" })
+}
+
+// unescape handles the escape sequences that are allowed in all
+// string values.
+func unescape(val string) string {
+	if !strings.Contains(val, `\`) {
+		return val
+	}
+
+	r := strings.NewReplacer(`\s`, " ", `\n`, "\n", `\t`, "\t", `\r`, "\r", `\\`, `\`)
+	return r.Replace(val)
+}
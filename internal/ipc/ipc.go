@@ -0,0 +1,232 @@
+// Package ipc defines the protocol used to control a running kawa
+// instance over its Unix socket.
+//
+// Clients connect to the socket named by the KAWA_SOCKET environment
+// variable and send requests as JSON objects, one per line. kawa
+// replies to each request, in order, with a single JSON response
+// object, also on its own line.
+//
+// A subscribe request turns the connection into an event stream.
+// After the response to the subscription, kawa sends an Event object
+// on its own line whenever something happens, and no further requests
+// are read from the connection.
+package ipc
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+)
+
+// SocketEnv is the environment variable that kawa sets to the path
+// of its control socket.
+const SocketEnv = "KAWA_SOCKET"
+
+// Commands that may be sent in a Request.
+const (
+	CommandViews     = "views"
+	CommandOutputs   = "outputs"
+	CommandFocus     = "focus"
+	CommandMove      = "move"
+	CommandResize    = "resize"
+	CommandClose     = "close"
+	CommandHide      = "hide"
+	CommandUnhide    = "unhide"
+	CommandTile      = "tile"
+	CommandAction    = "action"
+	CommandSubscribe = "subscribe"
+
+	CommandConfigureOutput = "configure-output"
+	CommandPower           = "power"
+)
+
+// Power states for the power command.
+const (
+	PowerOn  = "on"
+	PowerOff = "off"
+
+	// PowerOffUntilInput turns an output off until the next time that
+	// there is any input.
+	PowerOffUntilInput = "off-until-input"
+)
+
+// Types of events that can be subscribed to.
+const (
+	EventViewNew          = "view-new"
+	EventViewMap          = "view-map"
+	EventViewDestroy      = "view-destroy"
+	EventViewFocus        = "view-focus"
+	EventViewTitle        = "view-title"
+	EventViewHide         = "view-hide"
+	EventViewUnhide       = "view-unhide"
+	EventViewTile         = "view-tile"
+	EventViewUntile       = "view-untile"
+	EventViewFullscreen   = "view-fullscreen"
+	EventViewUnfullscreen = "view-unfullscreen"
+	EventViewWorkspace    = "view-workspace"
+	EventOutputNew        = "output-new"
+	EventOutputDestroy    = "output-destroy"
+	EventOutputChange     = "output-change"
+	EventWorkspace        = "workspace"
+)
+
+// Request is a single command sent to kawa.
+type Request struct {
+	Command string `json:"command"`
+
+	// View is the ID of the view that the command applies to, if any.
+	View uint64 `json:"view,omitempty"`
+
+	// Bounds is the new position and size of the view for the move
+	// and resize commands. The move command ignores its size.
+	Bounds Rect `json:"bounds,omitzero"`
+
+	// Action is the name of the action to run for the action command.
+	// The names are the same as those used for key bindings.
+	Action string `json:"action,omitempty"`
+
+	// Output is the name of the output that the configure-output and
+	// power commands apply to. The power command also accepts "*" for
+	// every output.
+	Output string `json:"output,omitempty"`
+
+	// Power is the state to put the output in for the power command.
+	Power string `json:"power,omitempty"`
+
+	// Options are the changes to make for the configure-output command.
+	// They are key=value pairs in the same form as the options of the
+	// output directive in the config file, such as "scale=2" or
+	// "mode=1920x1080".
+	Options []string `json:"options,omitempty"`
+
+	// Events are the types of events to receive for the subscribe
+	// command. If it is empty, all events are sent.
+	Events []string `json:"events,omitempty"`
+}
+
+// Response is kawa's reply to a Request.
+type Response struct {
+	Error   string   `json:"error,omitempty"`
+	Views   []View   `json:"views,omitempty"`
+	Outputs []Output `json:"outputs,omitempty"`
+}
+
+// Event is sent to subscribed clients when something happens.
+type Event struct {
+	Type   string  `json:"type"`
+	View   *View   `json:"view,omitempty"`
+	Output *Output `json:"output,omitempty"`
+
+	// Workspace is the number of the new current workspace for
+	// workspace events.
+	Workspace int `json:"workspace,omitempty"`
+}
+
+// View describes a window.
+type View struct {
+	ID         uint64 `json:"id"`
+	Title      string `json:"title"`
+	PID        int    `json:"pid"`
+	Bounds     Rect   `json:"bounds"`
+	Mapped     bool   `json:"mapped"`
+	Focused    bool   `json:"focused"`
+	Tiled      bool   `json:"tiled"`
+	Hidden     bool   `json:"hidden"`
+	Fullscreen bool   `json:"fullscreen"`
+
+	// Workspace is the number of the workspace that the view is on,
+	// starting from 1, or 0 if the view is hidden.
+	Workspace int `json:"workspace"`
+}
+
+// Output describes a display.
+type Output struct {
+	Name      string  `json:"name"`
+	Bounds    Rect    `json:"bounds"`
+	Scale     float32 `json:"scale"`
+	StatusBar bool    `json:"status_bar"`
+
+	// On is whether the output is turned on. Outputs are off if they
+	// were turned off with the power command or if kawa has been idle
+	// for long enough.
+	On bool `json:"on"`
+}
+
+// Rect is a rectangle in layout coordinates.
+type Rect struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// Client is a connection to kawa's control socket.
+type Client struct {
+	conn net.Conn
+	enc  *json.Encoder
+	dec  *json.Decoder
+}
+
+// Dial connects to the control socket at path. If path is empty, the
+// value of the environment variable named by SocketEnv is used.
+func Dial(path string) (*Client, error) {
+	if path == "" {
+		path = os.Getenv(SocketEnv)
+		if path == "" {
+			return nil, errors.New(SocketEnv + " is not set")
+		}
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		conn: conn,
+		enc:  json.NewEncoder(conn),
+		dec:  json.NewDecoder(bufio.NewReader(conn)),
+	}, nil
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Do sends req and waits for the response. If kawa reports an error,
+// it is returned along with the response.
+func (c *Client) Do(req Request) (Response, error) {
+	err := c.enc.Encode(req)
+	if err != nil {
+		return Response{}, err
+	}
+
+	var rsp Response
+	err = c.dec.Decode(&rsp)
+	if err != nil {
+		return Response{}, err
+	}
+	if rsp.Error != "" {
+		return rsp, errors.New(rsp.Error)
+	}
+
+	return rsp, nil
+}
+
+// Subscribe subscribes to the given types of events, or to all of
+// them if none are given. After it returns successfully, no more
+// requests can be made with c.
+func (c *Client) Subscribe(events ...string) error {
+	_, err := c.Do(Request{Command: CommandSubscribe, Events: events})
+	return err
+}
+
+// Next waits for the next event after a successful call to Subscribe.
+func (c *Client) Next() (Event, error) {
+	var ev Event
+	err := c.dec.Decode(&ev)
+	return ev, err
+}
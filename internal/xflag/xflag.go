@@ -24,3 +24,20 @@ func (s *stringsFlag) Set(v string) error {
 func StringsFlag(name string, value []string, usage string) *[]string {
 	return (*[]string)(Flag(name, (*stringsFlag)(&value), usage))
 }
+
+// repeatedFlag collects the value of every use of the flag as is,
+// without splitting it.
+type repeatedFlag []string
+
+func (s repeatedFlag) String() string {
+	return strings.Join(s, " ")
+}
+
+func (s *repeatedFlag) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+func RepeatedFlag(name string, value []string, usage string) *[]string {
+	return (*[]string)(Flag(name, (*repeatedFlag)(&value), usage))
+}
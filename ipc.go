@@ -0,0 +1,423 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"deedles.dev/kawa/internal/ipc"
+	"deedles.dev/wlr"
+	"deedles.dev/ximage/geom"
+)
+
+const (
+	// ipcEventBuffer is the number of events that can be queued for a
+	// subscriber before it is considered to have stopped responding.
+	ipcEventBuffer = 256
+)
+
+// ipcSocketPath returns the path of the control socket for the given
+// Wayland socket name.
+func ipcSocketPath(display string) string {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, fmt.Sprintf("kawa.%v.sock", display))
+}
+
+// startIPC starts listening for connections on the control socket.
+func (server *Server) startIPC(display string) error {
+	path := ipcSocketPath(display)
+	os.Remove(path)
+
+	lis, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return err
+	}
+	server.ipcListener = lis
+
+	os.Setenv(ipc.SocketEnv, path)
+	wlr.Log(wlr.Info, "Listening for IPC connections on %v=%v", ipc.SocketEnv, path)
+
+	go server.acceptIPC(lis)
+	return nil
+}
+
+func (server *Server) stopIPC() {
+	if server.ipcListener == nil {
+		return
+	}
+
+	// The socket file is removed automatically when the listener is
+	// closed.
+	server.ipcListener.Close()
+}
+
+func (server *Server) acceptIPC(lis *net.UnixListener) {
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				wlr.Log(wlr.Error, "accept IPC connection: %v", err)
+			}
+			return
+		}
+
+		go server.handleIPCConn(conn)
+	}
+}
+
+func (server *Server) handleIPCConn(conn net.Conn) {
+	defer conn.Close()
+
+	dec := json.NewDecoder(bufio.NewReader(conn))
+	enc := json.NewEncoder(conn)
+	for {
+		var req ipc.Request
+		err := dec.Decode(&req)
+		if err != nil {
+			return
+		}
+
+		if req.Command == ipc.CommandSubscribe {
+			server.streamIPCEvents(enc, req.Events)
+			return
+		}
+
+		// Requests are handled on the main goroutine because they
+		// touch compositor state.
+		c := make(chan ipc.Response, 1)
+		server.post(func() { c <- server.handleIPCRequest(req) })
+
+		err = enc.Encode(<-c)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// ipcSubscriber is a connection that has subscribed to events.
+type ipcSubscriber struct {
+	events chan ipc.Event
+	filter []string
+}
+
+// streamIPCEvents sends events to a subscribed connection until
+// either the connection fails or the subscriber is dropped for not
+// keeping up.
+func (server *Server) streamIPCEvents(enc *json.Encoder, filter []string) {
+	sub := ipcSubscriber{
+		events: make(chan ipc.Event, ipcEventBuffer),
+		filter: filter,
+	}
+	server.post(func() { server.subscribers = append(server.subscribers, &sub) })
+	defer server.post(func() { server.unsubscribe(&sub) })
+
+	err := enc.Encode(ipc.Response{})
+	if err != nil {
+		return
+	}
+
+	for ev := range sub.events {
+		err := enc.Encode(ev)
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (server *Server) unsubscribe(sub *ipcSubscriber) {
+	i := slices.Index(server.subscribers, sub)
+	if i < 0 {
+		return
+	}
+
+	server.subscribers = slices.Delete(server.subscribers, i, i+1)
+	close(sub.events)
+}
+
+// emit sends an event to all interested subscribers. Subscribers
+// whose buffers are full are dropped rather than blocking the
+// compositor.
+func (server *Server) emit(ev ipc.Event) {
+	for _, sub := range slices.Clone(server.subscribers) {
+		if (len(sub.filter) != 0) && !slices.Contains(sub.filter, ev.Type) {
+			continue
+		}
+
+		select {
+		case sub.events <- ev:
+		default:
+			wlr.Log(wlr.Error, "dropping IPC subscriber that isn't keeping up")
+			server.unsubscribe(sub)
+		}
+	}
+}
+
+func (server *Server) emitView(t string, view *View) {
+	if len(server.subscribers) == 0 {
+		return
+	}
+
+	v := server.ipcView(view, server.focusedView())
+	server.emit(ipc.Event{Type: t, View: &v})
+}
+
+func (server *Server) emitOutput(t string, out *Output) {
+	if len(server.subscribers) == 0 {
+		return
+	}
+
+	o := server.ipcOutput(out)
+	server.emit(ipc.Event{Type: t, Output: &o})
+}
+
+func (server *Server) handleIPCRequest(req ipc.Request) ipc.Response {
+	switch req.Command {
+	case ipc.CommandViews:
+		return ipc.Response{Views: server.ipcViews()}
+
+	case ipc.CommandOutputs:
+		return ipc.Response{Outputs: server.ipcOutputs()}
+
+	case ipc.CommandConfigureOutput:
+		return server.ipcConfigureOutput(req)
+
+	case ipc.CommandPower:
+		return server.ipcPower(req)
+
+	case ipc.CommandAction:
+		action, ok := actions[req.Action]
+		if !ok {
+			return ipcError(fmt.Errorf("unknown action %q", req.Action))
+		}
+		action(server)
+		return ipc.Response{}
+	}
+
+	cmd, ok := ipcViewCommands[req.Command]
+	if !ok {
+		return ipcError(fmt.Errorf("unknown command %q", req.Command))
+	}
+
+	view := server.viewByID(req.View)
+	if view == nil {
+		return ipcError(fmt.Errorf("no view with ID %v", req.View))
+	}
+
+	ws := server.workspaceOf(view)
+	if (ws >= 0) && (ws != server.workspace) {
+		switch req.Command {
+		case ipc.CommandFocus:
+			server.switchWorkspace(ws)
+		case ipc.CommandClose, ipc.CommandHide:
+		default:
+			return ipcError(errors.New("view is on another workspace"))
+		}
+	}
+
+	return ipcError(cmd(server, view, req))
+}
+
+var ipcViewCommands = map[string]func(*Server, *View, ipc.Request) error{
+	ipc.CommandFocus:  (*Server).ipcFocus,
+	ipc.CommandMove:   (*Server).ipcMove,
+	ipc.CommandResize: (*Server).ipcResize,
+	ipc.CommandClose:  (*Server).ipcClose,
+	ipc.CommandHide:   (*Server).ipcHide,
+	ipc.CommandUnhide: (*Server).ipcUnhide,
+	ipc.CommandTile:   (*Server).ipcTile,
+}
+
+func ipcError(err error) ipc.Response {
+	if err == nil {
+		return ipc.Response{}
+	}
+	return ipc.Response{Error: err.Error()}
+}
+
+func ipcRect(r geom.Rect[float64]) ipc.Rect {
+	return ipc.Rect{X: r.Min.X, Y: r.Min.Y, Width: r.Dx(), Height: r.Dy()}
+}
+
+func (server *Server) ipcViews() []ipc.View {
+	focused := server.focusedView()
+
+	var views []ipc.View
+	for _, view := range slices.Concat(server.tiled, server.views, server.otherWorkspaceViews(), server.hidden) {
+		views = append(views, server.ipcView(view, focused))
+	}
+	return views
+}
+
+func (server *Server) ipcView(view *View, focused *View) ipc.View {
+	return ipc.View{
+		ID:      view.ID,
+		Title:   view.Title(),
+		PID:     view.PID(),
+		Bounds:  ipcRect(view.Bounds()),
+		Mapped:  view.Mapped(),
+		Focused: view == focused,
+		Tiled:   server.isViewTiled(view),
+		Hidden:  server.isViewHidden(view),
+
+		Fullscreen: view.Fullscreen != nil,
+		Workspace:  server.workspaceOf(view) + 1,
+	}
+}
+
+func (server *Server) ipcOutputs() []ipc.Output {
+	outputs := make([]ipc.Output, 0, len(server.outputs))
+	for _, out := range server.outputs {
+		outputs = append(outputs, server.ipcOutput(out))
+	}
+	return outputs
+}
+
+func (server *Server) ipcOutput(out *Output) ipc.Output {
+	return ipc.Output{
+		Name:      out.Output.Name(),
+		Bounds:    ipcRect(server.outputBounds(out)),
+		Scale:     out.Output.Scale(),
+		StatusBar: out == server.statusBar.Output(),
+		On:        !out.poweredOff && !server.idle,
+	}
+}
+
+// ipcConfigureOutput changes the settings of an output. Anything that
+// the request doesn't change is kept as it is now, and the result is
+// remembered in case the output is disconnected and reconnected.
+func (server *Server) ipcConfigureOutput(req ipc.Request) ipc.Response {
+	i := slices.IndexFunc(server.outputs, func(out *Output) bool { return out.Output.Name() == req.Output })
+	if i < 0 {
+		return ipcError(fmt.Errorf("no output named %q", req.Output))
+	}
+	out := server.outputs[i]
+
+	config := server.currentOutputConfig(out)
+	err := parseOutputOptions(&config, req.Options)
+	if err != nil {
+		return ipcError(err)
+	}
+	// Only a requested mode is checked, as outputs on some backends
+	// have no list of modes at all, and the current one might be a
+	// custom mode that isn't in the list.
+	setsMode := slices.ContainsFunc(req.Options, func(opt string) bool { return strings.HasPrefix(opt, "mode=") })
+	if setsMode && !hasMode(out, config.Width, config.Height) {
+		return ipcError(fmt.Errorf("output %v has no %vx%v mode", req.Output, config.Width, config.Height))
+	}
+	if config.Scale <= 0 {
+		return ipcError(errors.New("scale must be positive"))
+	}
+
+	server.setOutputConfig(config)
+	server.reconfigureOutput(out, &config)
+
+	return ipc.Response{Outputs: []ipc.Output{server.ipcOutput(out)}}
+}
+
+func (server *Server) ipcPower(req ipc.Request) ipc.Response {
+	var on, wake bool
+	switch req.Power {
+	case ipc.PowerOn:
+		on = true
+	case ipc.PowerOff:
+	case ipc.PowerOffUntilInput:
+		wake = true
+	default:
+		return ipcError(fmt.Errorf("unknown power state %q", req.Power))
+	}
+
+	outputs := slices.DeleteFunc(slices.Clone(server.outputs), func(out *Output) bool {
+		return (req.Output != "*") && (out.Output.Name() != req.Output)
+	})
+	if len(outputs) == 0 {
+		return ipcError(fmt.Errorf("no output named %q", req.Output))
+	}
+
+	rsp := ipc.Response{Outputs: make([]ipc.Output, 0, len(outputs))}
+	for _, out := range outputs {
+		server.setOutputPower(out, on, wake)
+		rsp.Outputs = append(rsp.Outputs, server.ipcOutput(out))
+	}
+	return rsp
+}
+
+func (server *Server) ipcFocus(view *View, req ipc.Request) error {
+	if server.isViewHidden(view) {
+		server.unhideView(view)
+		return nil
+	}
+	if !view.Mapped() {
+		return errors.New("view is not mapped")
+	}
+
+	server.focusView(view, view.Surface())
+	return nil
+}
+
+func (server *Server) ipcMove(view *View, req ipc.Request) error {
+	if server.isViewTiled(view) || server.isViewHidden(view) || (view.Fullscreen != nil) {
+		return errors.New("only floating views can be moved")
+	}
+
+	vb := view.Bounds()
+	off := view.Coords.Sub(vb.Min)
+	server.moveViewTo(nil, view, geom.Pt(req.Bounds.X, req.Bounds.Y).Add(off))
+	return nil
+}
+
+func (server *Server) ipcResize(view *View, req ipc.Request) error {
+	if server.isViewTiled(view) || server.isViewHidden(view) || (view.Fullscreen != nil) {
+		return errors.New("only floating views can be resized")
+	}
+	if (req.Bounds.Width < MinWidth) || (req.Bounds.Height < MinHeight) {
+		return fmt.Errorf("views must be at least %vx%v", MinWidth, MinHeight)
+	}
+
+	r := geom.Rt(0, 0, req.Bounds.Width, req.Bounds.Height).Add(geom.Pt(req.Bounds.X, req.Bounds.Y))
+	server.resizeViewTo(nil, view, r)
+	return nil
+}
+
+func (server *Server) ipcClose(view *View, req ipc.Request) error {
+	server.closeView(view)
+	return nil
+}
+
+func (server *Server) ipcHide(view *View, req ipc.Request) error {
+	if server.isViewHidden(view) {
+		return errors.New("view is already hidden")
+	}
+
+	server.hideView(view)
+	return nil
+}
+
+func (server *Server) ipcUnhide(view *View, req ipc.Request) error {
+	if !server.isViewHidden(view) {
+		return errors.New("view is not hidden")
+	}
+
+	server.unhideView(view)
+	return nil
+}
+
+func (server *Server) ipcTile(view *View, req ipc.Request) error {
+	if server.isViewHidden(view) {
+		return errors.New("hidden views can't be tiled")
+	}
+	if !view.Mapped() {
+		return errors.New("view is not mapped")
+	}
+
+	server.toggleViewTiling(view)
+	return nil
+}
@@ -4,14 +4,14 @@ import (
 	"errors"
 	"flag"
 	"fmt"
-	"iter"
 	"log"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
-	"slices"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 
 	_ "image/gif"
 	_ "image/jpeg"
@@ -46,42 +46,73 @@ func parseTransform(str string) (wlr.OutputTransform, error) {
 	}
 }
 
-// parseOutputConfigs parses an OutputConfig from a string.
-func parseOutputConfigs(outputConfigs string) iter.Seq[OutputConfig] {
-	return func(yield func(OutputConfig) bool) {
-		if outputConfigs == "" {
-			return
+// parseOutputConfigs parses a comma-separated list of OutputConfigs
+// from a string.
+func parseOutputConfigs(outputConfigs string) ([]OutputConfig, error) {
+	if outputConfigs == "" {
+		return nil, nil
+	}
+
+	var configs []OutputConfig
+	for config := range strings.SplitSeq(outputConfigs, ",") {
+		c, err := parseOutputConfig(config)
+		if err != nil {
+			return nil, fmt.Errorf("output config %q: %w", config, err)
 		}
+		configs = append(configs, c)
+	}
+	return configs, nil
+}
 
-		// TODO: Handle errors.
-		for config := range strings.SplitSeq(outputConfigs, ",") {
-			parts := strings.Split(config, ":")
-			c := OutputConfig{Name: parts[0]}
-			c.X, _ = strconv.Atoi(parts[1])
-			c.Y, _ = strconv.Atoi(parts[2])
-			if len(parts) >= 5 {
-				c.Width, _ = strconv.Atoi(parts[3])
-				c.Height, _ = strconv.Atoi(parts[4])
-			}
-			if len(parts) >= 6 {
-				scale, _ := strconv.ParseFloat(parts[5], 32)
-				c.Scale = float32(scale)
-			}
-			if len(parts) >= 7 {
-				c.Transform, _ = parseTransform(parts[6])
-			}
+// parseOutputConfig parses a single OutputConfig of the form
+// name:x:y[:width:height][:scale][:transform].
+func parseOutputConfig(config string) (c OutputConfig, err error) {
+	parts := strings.Split(config, ":")
+	if (len(parts) < 3) || (len(parts) == 4) {
+		return c, errors.New("expected name:x:y[:width:height][:scale][:transform]")
+	}
 
-			if !yield(c) {
-				return
-			}
+	c.Name = parts[0]
+	c.X, err = strconv.Atoi(parts[1])
+	if err != nil {
+		return c, err
+	}
+	c.Y, err = strconv.Atoi(parts[2])
+	if err != nil {
+		return c, err
+	}
+	if len(parts) >= 5 {
+		c.Width, err = strconv.Atoi(parts[3])
+		if err != nil {
+			return c, err
+		}
+		c.Height, err = strconv.Atoi(parts[4])
+		if err != nil {
+			return c, err
+		}
+	}
+	if len(parts) >= 6 {
+		scale, err := strconv.ParseFloat(parts[5], 32)
+		if err != nil {
+			return c, err
+		}
+		c.Scale = float32(scale)
+	}
+	if len(parts) >= 7 {
+		c.Transform, err = parseTransform(parts[6])
+		if err != nil {
+			return c, err
 		}
 	}
+
+	return c, nil
 }
 
 // init initializes the boilerplate necessary to get wlroots up and
 // running, as well as a few other pieces of initialization.
 func (server *Server) init() error {
 	server.newViews = make(map[int]*geom.Rect[float64])
+	server.autostartProcs = make(map[int]*autostartProc)
 
 	server.display = wlr.CreateDisplay()
 
@@ -111,6 +142,17 @@ func (server *Server) init() error {
 
 	wlr.CreateGammaControlManagerV1(server.display)
 
+	// TODO: Create zwlr_foreign_toplevel_manager_v1 and
+	// ext-foreign-toplevel-list and publish a handle for every view
+	// once deedles.dev/wlr has bindings for them. Until then, taskbars
+	// have to use the IPC socket, which can already list, focus, close,
+	// hide, unhide and tile views.
+
+	// TODO: Create ext-session-lock-v1 once deedles.dev/wlr has bindings
+	// for it. While locked, only the lock surfaces should be rendered
+	// and receive input, and a solid color should be shown if the
+	// locker dies.
+
 	server.onNewOutputListener = server.backend.OnNewOutput(server.onNewOutput)
 
 	server.outputLayout = wlr.CreateOutputLayout()
@@ -139,8 +181,11 @@ func (server *Server) init() error {
 	server.xdgShell = wlr.CreateXDGShell(server.display, 3)
 	server.onNewXDGSurfaceListener = server.xdgShell.OnNewSurface(server.onNewXDGSurface)
 
-	server.layerShell = wlr.CreateLayerShellV1(server.display, 4)
-	server.onNewLayerSurfaceListener = server.layerShell.OnNewSurface(server.onNewLayerSurface)
+	// TODO: Advertise the layer shell again once deedles.dev/wlr can
+	// configure layer surfaces. Without that, clients wait forever for
+	// their first configure, so it's better for them to see that the
+	// global is missing and exit with a useful error. onNewLayerSurface
+	// is ready to be hooked up to it.
 
 	server.decorationManager = wlr.CreateServerDecorationManager(server.display)
 	server.decorationManager.SetDefaultMode(wlr.ServerDecorationManagerModeServer)
@@ -163,6 +208,20 @@ func (server *Server) run() error {
 	server.xwayland = wlr.CreateXwayland(server.display, server.compositor, false)
 	server.onNewXwaylandSurfaceListener = server.xwayland.OnNewSurface(server.onNewXwaylandSurface)
 
+	err := server.queue.init()
+	if err != nil {
+		return err
+	}
+
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	defer signal.Stop(sighup)
+	go func() {
+		for range sighup {
+			server.post(server.reloadConfig)
+		}
+	}()
+
 	socket, err := server.display.AddSocketAuto()
 	if err != nil {
 		return err
@@ -181,9 +240,16 @@ func (server *Server) run() error {
 		wlr.Log(wlr.Info, "Running Xwayland on DISPLAY=%v", server.xwayland.Server().DisplayName())
 	}
 
-	server.display.Run()
+	err = server.startIPC(socket)
+	if err != nil {
+		wlr.Log(wlr.Error, "start IPC: %v", err)
+	}
+
+	server.apps = desktopApps()
+	server.startAutostart()
+	server.resetIdle()
 
-	return nil
+	return server.loop()
 }
 
 func main() {
@@ -193,39 +259,80 @@ func main() {
 
 	wlr.InitLog(wlr.Debug, nil)
 
-	terms := xflag.StringsFlag("terms", []string{"sakura", "alacritty"}, "preferentially ordered list of terminals for new windows to use")
+	configPath := flag.String("config", defaultConfigPath(), "config file")
+	terms := xflag.StringsFlag("terms", DefaultTerms, "preferentially ordered list of terminals for new windows to use")
 	bg := flag.String("bg", "", "background image")
 	bgScale := flag.String("bgscale", "stretch", "background image scaling method (stretch, center, fit, fill)")
 	outputConfigs := flag.String("out", "", "output configs (name:x:y[:width:height][:scale][:transform])")
+	binds := xflag.StringsFlag("bind", nil, "keyboard shortcuts to add to the configured ones (mod+mod+key=action)")
+	autostart := xflag.RepeatedFlag("autostart", nil, "command to run on startup (can be repeated)")
 	flag.Parse()
 
-	outputConfigsParsed := parseOutputConfigs(*outputConfigs)
+	loadConfig := func() (*Config, error) {
+		config, err := LoadConfig(*configPath)
+		if err != nil {
+			return nil, err
+		}
+
+		// Flags that were explicitly set override the config file,
+		// except for -bind, which adds to its bindings.
+		flag.Visit(func(f *flag.Flag) {
+			if err != nil {
+				return
+			}
+
+			switch f.Name {
+			case "terms":
+				config.Terms = *terms
+			case "bg":
+				config.BG = *bg
+			case "bgscale":
+				if _, ok := scaleFuncs[*bgScale]; !ok {
+					err = fmt.Errorf("unknown scaling method: %q", *bgScale)
+					return
+				}
+				config.BGScale = *bgScale
+			case "out":
+				config.Outputs, err = parseOutputConfigs(*outputConfigs)
+			case "bind":
+				var bindings []Binding
+				bindings, err = parseBindings(*binds)
+				config.Bindings = append(config.Bindings, bindings...)
+			case "autostart":
+				config.Autostart = nil
+				for _, command := range *autostart {
+					if strings.TrimSpace(command) == "" {
+						continue
+					}
+					config.Autostart = append(config.Autostart, parseAutostartCommand(command, false))
+				}
+			}
+		})
+		if err != nil {
+			return nil, fmt.Errorf("parse flags: %w", err)
+		}
+
+		return config, nil
+	}
+
 	server := Server{
-		Terms:         *terms,
-		OutputConfigs: slices.Collect(outputConfigsParsed),
+		LoadConfig: loadConfig,
 	}
 
-	err := server.init()
+	config, err := server.LoadConfig()
+	if err != nil {
+		wlr.Log(wlr.Error, "load config: %v", err)
+		os.Exit(2)
+	}
+	server.setConfig(config)
+
+	err = server.init()
 	if err != nil {
 		wlr.Log(wlr.Error, "init server: %v", err)
 		os.Exit(1)
 	}
 
-	if *bg != "" {
-		server.loadBG(*bg)
-		switch *bgScale {
-		case "stretch":
-			server.bgScale = scaleStretch
-		case "center":
-			server.bgScale = scaleCenter
-		case "fit":
-			server.bgScale = scaleFit
-		case "fill":
-			server.bgScale = scaleFill
-		default:
-			wlr.Log(wlr.Error, "unknown scaling method: %q", *bgScale)
-		}
-	}
+	server.setBG(config.BG, config.BGScale)
 
 	err = server.run()
 	if err != nil {
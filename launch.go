@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"iter"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"deedles.dev/kawa/internal/desktop"
+	"deedles.dev/wlr"
+	"deedles.dev/ximage/geom"
+)
+
+// The menus that user-defined commands can be added to.
+const (
+	MenuMain   = "main"
+	MenuSystem = "system"
+)
+
+// MenuCommand is a menu entry, defined in the config file, that runs
+// a shell command.
+type MenuCommand struct {
+	Menu    string
+	Label   string
+	Command string
+
+	// Sweep is whether a rectangle is swept out before the command is
+	// run, as with New, so that the window that it opens is placed in
+	// it.
+	Sweep bool
+}
+
+// parseMenuCommand parses the arguments of a menu or sweepmenu
+// directive, which are the name of the menu followed by the label of
+// the entry and the command, separated by a lone =.
+func parseMenuCommand(args []string, sweep bool) (MenuCommand, error) {
+	if len(args) == 0 {
+		return MenuCommand{}, errors.New("menu requires a menu name")
+	}
+	if (args[0] != MenuMain) && (args[0] != MenuSystem) {
+		return MenuCommand{}, fmt.Errorf("unknown menu %q", args[0])
+	}
+
+	i := slices.Index(args, "=")
+	if i < 0 {
+		return MenuCommand{}, errors.New("menu requires a label and a command separated by =")
+	}
+	label := strings.Join(args[1:i], " ")
+	command := strings.Join(args[i+1:], " ")
+	if label == "" {
+		return MenuCommand{}, errors.New("menu requires a label")
+	}
+	if command == "" {
+		return MenuCommand{}, errors.New("menu requires a command")
+	}
+
+	return MenuCommand{
+		Menu:    args[0],
+		Label:   label,
+		Command: command,
+		Sweep:   sweep,
+	}, nil
+}
+
+// commandMenuItems yields items for the user-defined commands that
+// belong in the named menu.
+func (server *Server) commandMenuItems(menu string) iter.Seq[*MenuItem] {
+	return func(yield func(*MenuItem) bool) {
+		for _, c := range server.MenuCommands {
+			if c.Menu != menu {
+				continue
+			}
+
+			item := NewTextMenuItem(server.renderer, c.Label)
+			item.OnSelect = func() {
+				server.runMenuCommand(c)
+			}
+			if !yield(item) {
+				return
+			}
+		}
+	}
+}
+
+func (server *Server) runMenuCommand(c MenuCommand) {
+	run := func(to *geom.Rect[float64]) {
+		cmd := exec.Command("/bin/sh", "-c", c.Command)
+		err := server.spawn(cmd, to)
+		if err != nil {
+			wlr.Log(wlr.Error, "run %q: %v", c.Command, err)
+		}
+	}
+
+	if c.Sweep {
+		server.startSweep(run)
+		return
+	}
+	run(nil)
+}
+
+// spawn starts cmd. If to isn't nil, the first window that the
+// process, or any process that it starts, opens within NewViewTimeout
+// is placed in it.
+func (server *Server) spawn(cmd *exec.Cmd, to *geom.Rect[float64]) error {
+	if cmd.SysProcAttr == nil {
+		// The process is put in a session of its own so that windows
+		// opened by its children can be traced back to it even after
+		// it has exited.
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	}
+
+	err := cmd.Start()
+	if err != nil {
+		return err
+	}
+	go cmd.Wait()
+
+	if to == nil {
+		return nil
+	}
+
+	pid := cmd.Process.Pid
+	server.newViews[pid] = to
+	server.after(NewViewTimeout, func() {
+		if server.newViews[pid] == to {
+			delete(server.newViews, pid)
+		}
+	})
+	return nil
+}
+
+// newViewFor finds the rectangle that was swept out for the process
+// pid. Along with pid itself, the session that it is in and the
+// processes that it was started by are checked, so that programs that
+// fork before opening a window are found. It returns the key of the
+// rectangle in newViews.
+//
+// Views that can't be traced back to a process, such as Xwayland ones
+// or those of programs started via D-Bus activation, are never found.
+func (server *Server) newViewFor(pid int) (int, *geom.Rect[float64], bool) {
+	if (pid <= 0) || (len(server.newViews) == 0) {
+		return 0, nil, false
+	}
+
+	if nv, ok := server.newViews[pid]; ok {
+		return pid, nv, true
+	}
+
+	_, sid, err := procStat(pid)
+	if err == nil {
+		if nv, ok := server.newViews[sid]; ok {
+			return sid, nv, true
+		}
+	}
+
+	for p := pid; p > 1; {
+		ppid, _, err := procStat(p)
+		if err != nil {
+			break
+		}
+		if nv, ok := server.newViews[ppid]; ok {
+			return ppid, nv, true
+		}
+		p = ppid
+	}
+
+	return 0, nil, false
+}
+
+// procStat returns the parent process and session IDs of the process
+// pid.
+func procStat(pid int) (ppid, sid int, err error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%v/stat", pid))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// The command name is in parentheses and can contain anything,
+	// including spaces and parentheses, so the fields are found after
+	// the last closing one.
+	i := bytes.LastIndexByte(data, ')')
+	if i < 0 {
+		return 0, 0, fmt.Errorf("malformed stat for process %v", pid)
+	}
+	fields := strings.Fields(string(data[i+1:]))
+	if len(fields) < 4 {
+		return 0, 0, fmt.Errorf("malformed stat for process %v", pid)
+	}
+
+	ppid, err = strconv.Atoi(fields[1])
+	if err != nil {
+		return 0, 0, err
+	}
+	sid, err = strconv.Atoi(fields[3])
+	if err != nil {
+		return 0, 0, err
+	}
+	return ppid, sid, nil
+}
+
+// appsMenu creates a menu of the applications that had desktop entries
+// when they were last loaded.
+func (server *Server) appsMenu() *Menu {
+	if len(server.apps) == 0 {
+		return nil
+	}
+
+	items := func(yield func(*MenuItem) bool) {
+		for _, app := range server.apps {
+			item := NewTextMenuItem(server.renderer, app.name)
+			item.OnSelect = func() {
+				cmd := exec.Command(app.args[0], app.args[1:]...)
+				err := server.spawn(cmd, nil)
+				if err != nil {
+					wlr.Log(wlr.Error, "launch %v: %v", app.name, err)
+				}
+			}
+			if !yield(item) {
+				return
+			}
+		}
+	}
+
+	return NewMenuFromSeq(items, len(server.apps))
+}
+
+type desktopApp struct {
+	name string
+	args []string
+}
+
+// desktopApps returns the applications that should be shown in the
+// launcher, sorted by name. Applications that need to be run in a
+// terminal are left out.
+func desktopApps() []desktopApp {
+	desktops := currentDesktops()
+
+	var apps []desktopApp
+	for _, path := range desktop.ApplicationFiles() {
+		entry, err := desktop.ParseFile(path)
+		if err != nil {
+			wlr.Log(wlr.Debug, "launcher: %v", err)
+			continue
+		}
+		if (entry.Type != "Application") || (entry.Name == "") || entry.Hidden || entry.NoDisplay || entry.Terminal || !entry.ShownIn(desktops) {
+			continue
+		}
+		if entry.TryExec != "" {
+			if _, err := exec.LookPath(entry.TryExec); err != nil {
+				continue
+			}
+		}
+
+		args, err := entry.Args()
+		if err != nil {
+			wlr.Log(wlr.Debug, "launcher %v: %v", path, err)
+			continue
+		}
+
+		apps = append(apps, desktopApp{name: entry.Name, args: args})
+	}
+
+	slices.SortFunc(apps, func(a1, a2 desktopApp) int {
+		return cmp.Compare(strings.ToLower(a1.name), strings.ToLower(a2.name))
+	})
+	return apps
+}
@@ -17,5 +17,5 @@ type LayerSurface struct {
 }
 
 func (server *Server) onNewLayerSurface(surface wlr.LayerSurfaceV1) {
-	panic("Not implemented.")
+	wlr.Log(wlr.Error, "layer surfaces are not supported yet")
 }
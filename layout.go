@@ -0,0 +1,617 @@
+package main
+
+import (
+	"iter"
+	"slices"
+
+	"deedles.dev/wlr"
+	"deedles.dev/ximage/geom"
+)
+
+const (
+	DefaultLayout      = "grid"
+	DefaultMasterRatio = 0.55
+	DefaultTileGap     = 3 * DefaultWindowBorder
+
+	// MinMasterRatio and MaxMasterRatio limit how far the master
+	// ratio, and the share of any two tiles that are being resized,
+	// can be adjusted.
+	MinMasterRatio = 0.1
+	MaxMasterRatio = 0.9
+
+	gridColumns = 4
+)
+
+// A Layout arranges tiled views on an output.
+type Layout interface {
+	// Name is the name used to select the layout.
+	Name() string
+
+	// Tiles yields n tiles in r, one for each tiled view, in order.
+	Tiles(n int, r geom.Rect[float64], state *LayoutState) iter.Seq[geom.Rect[float64]]
+}
+
+// A ResizableLayout is a Layout whose tiles can be resized by dragging
+// the edges between them.
+type ResizableLayout interface {
+	Layout
+
+	// Resize adjusts state so that the given edges of tile i, out of
+	// n tiles laid out in r, move to p. Edges that can't be moved are
+	// ignored.
+	Resize(n int, r geom.Rect[float64], state *LayoutState, i int, edges wlr.Edges, p geom.Point[float64])
+
+	// ResizableEdges returns the edges of tile i, out of n, that Resize
+	// can move.
+	ResizableEdges(n, i int) wlr.Edges
+}
+
+// LayoutState holds the adjustable parts of a layout on one output in
+// one workspace.
+type LayoutState struct {
+	// Ratio is the share of the area that is given to the most
+	// important tile by layouts that have one.
+	Ratio float64
+
+	// Weights are the relative sizes of tiles that share a row or a
+	// column, by tile index. Missing weights are 1.
+	Weights []float64
+}
+
+func (state *LayoutState) weight(i int) float64 {
+	if i >= len(state.Weights) {
+		return 1
+	}
+	return state.Weights[i]
+}
+
+func (state *LayoutState) setWeight(i int, w float64) {
+	for len(state.Weights) <= i {
+		state.Weights = append(state.Weights, 1)
+	}
+	state.Weights[i] = w
+}
+
+// moveWeight moves the weight of tile from to index to, shifting the
+// ones in between along with their tiles.
+func (state *LayoutState) moveWeight(from, to int) {
+	last := max(from, to)
+	state.setWeight(last, state.weight(last))
+
+	w := state.Weights[from]
+	state.Weights = slices.Delete(state.Weights, from, from+1)
+	state.Weights = slices.Insert(state.Weights, to, w)
+}
+
+// weights returns the weights of the count tiles starting at first.
+func (state *LayoutState) weights(first, count int) []float64 {
+	ws := make([]float64, count)
+	for i := range ws {
+		ws[i] = state.weight(first + i)
+	}
+	return ws
+}
+
+// moveSplit moves the boundary between tiles first+j and first+j+1,
+// out of count tiles that share the span from lo to hi, to pos.
+func (state *LayoutState) moveSplit(first, count int, lo, hi float64, j int, pos float64) {
+	if (j < 0) || (j+1 >= count) {
+		return
+	}
+
+	ws := state.weights(first, count)
+	var total, before float64
+	for i, w := range ws {
+		total += w
+		if i < j {
+			before += w
+		}
+	}
+
+	a := lo + (hi-lo)*before/total
+	b := a + (hi-lo)*(ws[j]+ws[j+1])/total
+	f := min(max((pos-a)/(b-a), MinMasterRatio), MaxMasterRatio)
+
+	pair := ws[j] + ws[j+1]
+	state.setWeight(first+j, f*pair)
+	state.setWeight(first+j+1, (1-f)*pair)
+}
+
+var (
+	// layouts are the available layouts in the order that they are
+	// cycled through.
+	layouts = []Layout{
+		layoutGrid{},
+		layoutMasterStack{},
+		layoutColumns{},
+		layoutRows{},
+		layoutMonocle{},
+		layoutSpiral{},
+	}
+)
+
+func init() {
+	for _, layout := range layouts {
+		actions["layout-"+layout.Name()] = func(server *Server) {
+			server.setLayout(server.currentOutput(), layout)
+		}
+	}
+}
+
+// layoutByName returns the layout called name, or nil if there isn't
+// one.
+func layoutByName(name string) Layout {
+	i := slices.IndexFunc(layouts, func(layout Layout) bool { return layout.Name() == name })
+	if i < 0 {
+		return nil
+	}
+	return layouts[i]
+}
+
+// layoutGrid arranges tiles in rows of up to four. Only the widths of
+// tiles within a row can be resized.
+type layoutGrid struct{}
+
+func (layoutGrid) Name() string { return "grid" }
+
+func (layoutGrid) Tiles(n int, r geom.Rect[float64], state *LayoutState) iter.Seq[geom.Rect[float64]] {
+	return func(yield func(geom.Rect[float64]) bool) {
+		first := 0
+		for row := range geom.TiledEvenVertically(gridRows(n), r) {
+			count := min(n-first, gridColumns)
+			for tile := range splitWeighted(row, state.weights(first, count), false) {
+				if !yield(tile) {
+					return
+				}
+			}
+			first += count
+		}
+	}
+}
+
+func (layoutGrid) Resize(n int, r geom.Rect[float64], state *LayoutState, i int, edges wlr.Edges, p geom.Point[float64]) {
+	first := i - i%gridColumns
+	count := min(n-first, gridColumns)
+	col := i - first
+
+	if edges&wlr.EdgeRight != 0 {
+		state.moveSplit(first, count, r.Min.X, r.Max.X, col, p.X)
+	}
+	if edges&wlr.EdgeLeft != 0 {
+		state.moveSplit(first, count, r.Min.X, r.Max.X, col-1, p.X)
+	}
+}
+
+func (layoutGrid) ResizableEdges(n, i int) wlr.Edges {
+	first := i - i%gridColumns
+	count := min(n-first, gridColumns)
+	col := i - first
+
+	edges := wlr.EdgeNone
+	if col > 0 {
+		edges |= wlr.EdgeLeft
+	}
+	if col+1 < count {
+		edges |= wlr.EdgeRight
+	}
+	return edges
+}
+
+func gridRows(n int) int {
+	return (n + gridColumns - 1) / gridColumns
+}
+
+// layoutMasterStack gives the first tile the left side and stacks the
+// rest on the right.
+type layoutMasterStack struct{}
+
+func (layoutMasterStack) Name() string { return "master" }
+
+func (layoutMasterStack) Tiles(n int, r geom.Rect[float64], state *LayoutState) iter.Seq[geom.Rect[float64]] {
+	return func(yield func(geom.Rect[float64]) bool) {
+		if n == 1 {
+			yield(r)
+			return
+		}
+
+		master, stack := splitH(r, state.Ratio)
+		if !yield(master) {
+			return
+		}
+		for tile := range splitWeighted(stack, state.weights(1, n-1), true) {
+			if !yield(tile) {
+				return
+			}
+		}
+	}
+}
+
+func (layoutMasterStack) Resize(n int, r geom.Rect[float64], state *LayoutState, i int, edges wlr.Edges, p geom.Point[float64]) {
+	if n == 1 {
+		return
+	}
+
+	if ((i == 0) && (edges&wlr.EdgeRight != 0)) || ((i > 0) && (edges&wlr.EdgeLeft != 0)) {
+		state.Ratio = min(max((p.X-r.Min.X)/r.Dx(), MinMasterRatio), MaxMasterRatio)
+	}
+	if i == 0 {
+		return
+	}
+
+	if edges&wlr.EdgeBottom != 0 {
+		state.moveSplit(1, n-1, r.Min.Y, r.Max.Y, i-1, p.Y)
+	}
+	if edges&wlr.EdgeTop != 0 {
+		state.moveSplit(1, n-1, r.Min.Y, r.Max.Y, i-2, p.Y)
+	}
+}
+
+func (layoutMasterStack) ResizableEdges(n, i int) wlr.Edges {
+	switch {
+	case n == 1:
+		return wlr.EdgeNone
+	case i == 0:
+		return wlr.EdgeRight
+	}
+
+	edges := wlr.EdgeLeft
+	if i > 1 {
+		edges |= wlr.EdgeTop
+	}
+	if i+1 < n {
+		edges |= wlr.EdgeBottom
+	}
+	return edges
+}
+
+// layoutColumns arranges tiles side by side.
+type layoutColumns struct{}
+
+func (layoutColumns) Name() string { return "columns" }
+
+func (layoutColumns) Tiles(n int, r geom.Rect[float64], state *LayoutState) iter.Seq[geom.Rect[float64]] {
+	return splitWeighted(r, state.weights(0, n), false)
+}
+
+func (layoutColumns) Resize(n int, r geom.Rect[float64], state *LayoutState, i int, edges wlr.Edges, p geom.Point[float64]) {
+	if edges&wlr.EdgeRight != 0 {
+		state.moveSplit(0, n, r.Min.X, r.Max.X, i, p.X)
+	}
+	if edges&wlr.EdgeLeft != 0 {
+		state.moveSplit(0, n, r.Min.X, r.Max.X, i-1, p.X)
+	}
+}
+
+func (layoutColumns) ResizableEdges(n, i int) wlr.Edges {
+	edges := wlr.EdgeNone
+	if i > 0 {
+		edges |= wlr.EdgeLeft
+	}
+	if i+1 < n {
+		edges |= wlr.EdgeRight
+	}
+	return edges
+}
+
+// layoutRows stacks tiles on top of each other.
+type layoutRows struct{}
+
+func (layoutRows) Name() string { return "rows" }
+
+func (layoutRows) Tiles(n int, r geom.Rect[float64], state *LayoutState) iter.Seq[geom.Rect[float64]] {
+	return splitWeighted(r, state.weights(0, n), true)
+}
+
+func (layoutRows) Resize(n int, r geom.Rect[float64], state *LayoutState, i int, edges wlr.Edges, p geom.Point[float64]) {
+	if edges&wlr.EdgeBottom != 0 {
+		state.moveSplit(0, n, r.Min.Y, r.Max.Y, i, p.Y)
+	}
+	if edges&wlr.EdgeTop != 0 {
+		state.moveSplit(0, n, r.Min.Y, r.Max.Y, i-1, p.Y)
+	}
+}
+
+func (layoutRows) ResizableEdges(n, i int) wlr.Edges {
+	edges := wlr.EdgeNone
+	if i > 0 {
+		edges |= wlr.EdgeTop
+	}
+	if i+1 < n {
+		edges |= wlr.EdgeBottom
+	}
+	return edges
+}
+
+// layoutMonocle gives every tile the whole area. Only the frontmost
+// one is visible.
+type layoutMonocle struct{}
+
+func (layoutMonocle) Name() string { return "monocle" }
+
+func (layoutMonocle) Tiles(n int, r geom.Rect[float64], state *LayoutState) iter.Seq[geom.Rect[float64]] {
+	return func(yield func(geom.Rect[float64]) bool) {
+		for range n {
+			if !yield(r) {
+				return
+			}
+		}
+	}
+}
+
+// layoutSpiral gives each tile a share of the space left over by the
+// previous ones, turning clockwise as it goes.
+type layoutSpiral struct{}
+
+func (layoutSpiral) Name() string { return "spiral" }
+
+func (layoutSpiral) Tiles(n int, r geom.Rect[float64], state *LayoutState) iter.Seq[geom.Rect[float64]] {
+	return func(yield func(geom.Rect[float64]) bool) {
+		for i := range n - 1 {
+			var tile geom.Rect[float64]
+			switch i % 4 {
+			case 0:
+				tile, r = splitH(r, state.Ratio)
+			case 1:
+				tile, r = splitV(r, state.Ratio)
+			case 2:
+				r, tile = splitH(r, 1-state.Ratio)
+			case 3:
+				r, tile = splitV(r, 1-state.Ratio)
+			}
+			if !yield(tile) {
+				return
+			}
+		}
+		if n > 0 {
+			yield(r)
+		}
+	}
+}
+
+// Resize only moves the first split, as every split uses the same
+// ratio.
+func (layoutSpiral) Resize(n int, r geom.Rect[float64], state *LayoutState, i int, edges wlr.Edges, p geom.Point[float64]) {
+	if n == 1 {
+		return
+	}
+
+	if ((i == 0) && (edges&wlr.EdgeRight != 0)) || ((i == 1) && (edges&wlr.EdgeLeft != 0)) {
+		state.Ratio = min(max((p.X-r.Min.X)/r.Dx(), MinMasterRatio), MaxMasterRatio)
+	}
+}
+
+func (layoutSpiral) ResizableEdges(n, i int) wlr.Edges {
+	switch {
+	case n == 1:
+		return wlr.EdgeNone
+	case i == 0:
+		return wlr.EdgeRight
+	case i == 1:
+		return wlr.EdgeLeft
+	}
+	return wlr.EdgeNone
+}
+
+// splitWeighted splits r into parts proportional to weights, either
+// side by side or, if vertical is true, stacked.
+func splitWeighted(r geom.Rect[float64], weights []float64, vertical bool) iter.Seq[geom.Rect[float64]] {
+	return func(yield func(geom.Rect[float64]) bool) {
+		var total float64
+		for _, w := range weights {
+			total += w
+		}
+
+		var before float64
+		for _, w := range weights {
+			var tile geom.Rect[float64]
+			if vertical {
+				tile = geom.Rt(r.Min.X, r.Min.Y+r.Dy()*before/total, r.Max.X, r.Min.Y+r.Dy()*(before+w)/total)
+			} else {
+				tile = geom.Rt(r.Min.X+r.Dx()*before/total, r.Min.Y, r.Min.X+r.Dx()*(before+w)/total, r.Max.Y)
+			}
+			if !yield(tile) {
+				return
+			}
+			before += w
+		}
+	}
+}
+
+// splitH splits r into a left part that is ratio of its width and a
+// right part with the rest.
+func splitH(r geom.Rect[float64], ratio float64) (left, right geom.Rect[float64]) {
+	x := r.Min.X + r.Dx()*ratio
+	return geom.Rt(r.Min.X, r.Min.Y, x, r.Max.Y), geom.Rt(x, r.Min.Y, r.Max.X, r.Max.Y)
+}
+
+// splitV splits r into a top part that is ratio of its height and a
+// bottom part with the rest.
+func splitV(r geom.Rect[float64], ratio float64) (top, bottom geom.Rect[float64]) {
+	y := r.Min.Y + r.Dy()*ratio
+	return geom.Rt(r.Min.X, r.Min.Y, r.Max.X, y), geom.Rt(r.Min.X, y, r.Max.X, r.Max.Y)
+}
+
+// currentOutput returns the output that the cursor is on, or the first
+// output if it isn't on any.
+func (server *Server) currentOutput() *Output {
+	out := server.outputAt(server.cursorCoords())
+	if (out == nil) && (len(server.outputs) != 0) {
+		out = server.outputs[0]
+	}
+	return out
+}
+
+// layoutState returns the state of the current layout of out in the
+// current workspace. Each layout has its own state so that switching
+// layouts doesn't lose adjustments.
+func (server *Server) layoutState(out *Output) *LayoutState {
+	states := out.layoutStates[server.workspace]
+	state, ok := states[out.Layout.Name()]
+	if !ok {
+		state = &LayoutState{Ratio: server.MasterRatio}
+		states[out.Layout.Name()] = state
+	}
+	return state
+}
+
+// tileIndex returns the index of view among the views in tiled that
+// are tiled on the same output as it, which is the index that its
+// weight is stored at, or -1 if it isn't in tiled.
+func tileIndex(tiled []*View, view *View) int {
+	var i int
+	for _, v := range tiled {
+		if v == view {
+			return i
+		}
+		if v.TiledOn == view.TiledOn {
+			i++
+		}
+	}
+	return -1
+}
+
+// removeTileWeight removes the weight of view from the state of every
+// layout of the output that it is tiled on in workspace ws, so that
+// the tiles after it keep theirs. It must be called before view is
+// removed from tiled, which holds the tiles of that workspace.
+func (server *Server) removeTileWeight(ws int, tiled []*View, view *View) {
+	i := tileIndex(tiled, view)
+	if (i < 0) || (view.TiledOn == nil) {
+		return
+	}
+
+	for _, state := range view.TiledOn.layoutStates[ws] {
+		if i < len(state.Weights) {
+			state.Weights = slices.Delete(state.Weights, i, i+1)
+		}
+	}
+}
+
+// moveTileWeight moves the weight of view, which has just been moved
+// within the tiles of the current workspace from tile index from, to
+// its new index in every layout's state.
+func (server *Server) moveTileWeight(view *View, from int) {
+	to := tileIndex(server.tiled, view)
+	if (from < 0) || (to < 0) || (view.TiledOn == nil) {
+		return
+	}
+
+	for _, state := range view.TiledOn.layoutStates[server.workspace] {
+		state.moveWeight(from, to)
+	}
+}
+
+// insertTileWeight gives view, which has just been inserted into the
+// tiles of the current workspace, a default weight, moving the weights
+// of the tiles after it along with them.
+func (server *Server) insertTileWeight(view *View) {
+	i := tileIndex(server.tiled, view)
+	if (i < 0) || (view.TiledOn == nil) {
+		return
+	}
+
+	for _, state := range view.TiledOn.layoutStates[server.workspace] {
+		if i < len(state.Weights) {
+			state.Weights = slices.Insert(state.Weights, i, 1)
+		}
+	}
+}
+
+// resizeTile moves the given edges of the tiled view to p, if the
+// layout of the output that it is tiled on allows it.
+func (server *Server) resizeTile(view *View, edges wlr.Edges, p geom.Point[float64]) {
+	out := view.TiledOn
+	layout, ok := out.Layout.(ResizableLayout)
+	if !ok {
+		return
+	}
+
+	tiled := server.tiledOn(out)
+	i := slices.Index(tiled, view)
+	layout.Resize(len(tiled), server.outputTilingBounds(out), server.layoutState(out), i, edges, p)
+	server.layoutTiles(out)
+}
+
+// tileResizeEdges returns those of edges of the tiled view that the
+// layout of the output that it is tiled on can move.
+func (server *Server) tileResizeEdges(view *View, edges wlr.Edges) wlr.Edges {
+	if view.TiledOn == nil {
+		return wlr.EdgeNone
+	}
+	layout, ok := view.TiledOn.Layout.(ResizableLayout)
+	if !ok {
+		return wlr.EdgeNone
+	}
+
+	tiled := server.tiledOn(view.TiledOn)
+	i := slices.Index(tiled, view)
+	if i < 0 {
+		return wlr.EdgeNone
+	}
+	return edges & layout.ResizableEdges(len(tiled), i)
+}
+
+func (server *Server) setLayout(out *Output, layout Layout) {
+	if out == nil {
+		return
+	}
+
+	out.Layout = layout
+	server.layoutTiles(out)
+	server.showMessage("layout: " + layout.Name())
+}
+
+// cycleLayout switches the layout of out to the one dir places after
+// its current one.
+func (server *Server) cycleLayout(out *Output, dir int) {
+	if out == nil {
+		return
+	}
+
+	i := slices.Index(layouts, out.Layout)
+	i = (i + dir + len(layouts)) % len(layouts)
+	server.setLayout(out, layouts[i])
+}
+
+func (server *Server) adjustMasterRatio(out *Output, delta float64) {
+	if out == nil {
+		return
+	}
+
+	state := server.layoutState(out)
+	state.Ratio = min(max(state.Ratio+delta, MinMasterRatio), MaxMasterRatio)
+	server.layoutTiles(out)
+}
+
+func (server *Server) adjustTileGap(out *Output, delta float64) {
+	if out == nil {
+		return
+	}
+
+	out.TileGap = max(out.TileGap+delta, 0)
+	server.layoutTiles(out)
+}
+
+func (server *Server) actionNextLayout() {
+	server.cycleLayout(server.currentOutput(), 1)
+}
+
+func (server *Server) actionPrevLayout() {
+	server.cycleLayout(server.currentOutput(), -1)
+}
+
+func (server *Server) actionGrowMaster() {
+	server.adjustMasterRatio(server.currentOutput(), 0.05)
+}
+
+func (server *Server) actionShrinkMaster() {
+	server.adjustMasterRatio(server.currentOutput(), -0.05)
+}
+
+func (server *Server) actionGrowGap() {
+	server.adjustTileGap(server.currentOutput(), WindowBorder)
+}
+
+func (server *Server) actionShrinkGap() {
+	server.adjustTileGap(server.currentOutput(), -WindowBorder)
+}
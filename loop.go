@@ -0,0 +1,111 @@
+package main
+
+import (
+	"runtime"
+	"sync"
+	"syscall"
+	"time"
+)
+
+func init() {
+	// wlroots expects to always be called from the same thread, so the
+	// main goroutine, which runs the event loop, needs to stay on it.
+	runtime.LockOSThread()
+}
+
+// eventQueue holds functions that have been queued from other
+// goroutines to be run on the main goroutine.
+type eventQueue struct {
+	m     sync.Mutex
+	funcs []func()
+	wake  [2]int
+}
+
+func (q *eventQueue) init() error {
+	return syscall.Pipe2(q.wake[:], syscall.O_NONBLOCK|syscall.O_CLOEXEC)
+}
+
+func (q *eventQueue) close() {
+	syscall.Close(q.wake[0])
+	syscall.Close(q.wake[1])
+}
+
+func (q *eventQueue) push(f func()) {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	q.funcs = append(q.funcs, f)
+	if len(q.funcs) == 1 {
+		syscall.Write(q.wake[1], []byte{0})
+	}
+}
+
+func (q *eventQueue) drain() []func() {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	var buf [64]byte
+	for {
+		n, _ := syscall.Read(q.wake[0], buf[:])
+		if n <= 0 {
+			break
+		}
+	}
+
+	funcs := q.funcs
+	q.funcs = nil
+	return funcs
+}
+
+// post queues f to be run on the main goroutine. It is safe to call
+// from any goroutine.
+func (server *Server) post(f func()) {
+	server.queue.push(f)
+}
+
+// after runs f on the main goroutine once d has elapsed. Stopping the
+// returned timer after it has fired does not prevent f from running.
+func (server *Server) after(d time.Duration, f func()) *time.Timer {
+	return time.AfterFunc(d, func() { server.post(f) })
+}
+
+// loop runs the main event loop until the server is shut down. It is
+// used instead of the display's own Run method so that functions
+// posted from other goroutines can be run alongside Wayland events.
+func (server *Server) loop() error {
+	evl := server.display.EventLoop()
+
+	epfd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(epfd)
+
+	for _, fd := range []int{int(evl.Fd()), server.queue.wake[0]} {
+		ev := syscall.EpollEvent{Events: syscall.EPOLLIN, Fd: int32(fd)}
+		err := syscall.EpollCtl(epfd, syscall.EPOLL_CTL_ADD, fd, &ev)
+		if err != nil {
+			return err
+		}
+	}
+
+	events := make([]syscall.EpollEvent, 2)
+	for !server.done {
+		server.display.FlushClients()
+
+		_, err := syscall.EpollWait(epfd, events, -1)
+		if (err != nil) && (err != syscall.EINTR) {
+			return err
+		}
+
+		// Posted functions run first so that any idle sources that they
+		// add, such as for configure events, are dispatched right away
+		// instead of waiting for some fd to become ready again.
+		for _, f := range server.queue.drain() {
+			f()
+		}
+		evl.Dispatch(0)
+	}
+
+	return nil
+}
@@ -8,11 +8,15 @@ import (
 	"deedles.dev/kawa/draw"
 	"deedles.dev/wlr"
 	"deedles.dev/ximage/geom"
+	"deedles.dev/xiter"
 )
 
-var (
-	menuItemInset = geom.Pt(WindowBorder, WindowBorder)
-)
+// menuItemInset returns the space around the contents of a menu item.
+// It depends on WindowBorder, which can change when the config is
+// reloaded, so menus pick it up when they are created in initUI.
+func menuItemInset() geom.Point[int] {
+	return geom.Pt(int(WindowBorder), int(WindowBorder))
+}
 
 type Menu struct {
 	items  []*MenuItem
@@ -54,7 +58,7 @@ func (m *Menu) updateBounds(shrink bool) {
 	if shrink {
 		for i := range m.bounds {
 			m.bounds[i] = geom.Rect[float64]{
-				Max: geom.PConv[float64](m.items[i].Size().Add(menuItemInset)),
+				Max: geom.PConv[float64](m.items[i].Size().Add(menuItemInset())),
 			}
 		}
 	}
@@ -66,6 +70,20 @@ func (m *Menu) Item(i int) *MenuItem {
 	return m.items[i]
 }
 
+// Index returns the index of item in the menu, or -1 if it isn't in
+// it.
+func (m *Menu) Index(item *MenuItem) int {
+	return slices.Index(m.items, item)
+}
+
+// Filter returns a menu containing only the items for which keep
+// returns true. The items are shared with m, so the returned menu
+// must not be released.
+func (m *Menu) Filter(keep func(*MenuItem) bool) *Menu {
+	items := xiter.Filter(slices.Values(m.items), keep)
+	return NewMenuFromSeq(items, 0)
+}
+
 func (m *Menu) Bounds() (b geom.Rect[float64]) {
 	return geom.Rect[float64]{
 		Min: m.bounds[0].Min,
@@ -79,7 +97,9 @@ func (m *Menu) Select(item *MenuItem) {
 		return
 	}
 
-	item.OnSelect()
+	if item.OnSelect != nil {
+		item.OnSelect()
+	}
 	m.prev = item
 }
 
@@ -108,10 +128,17 @@ func (m *Menu) ItemBounds(item *MenuItem) geom.Rect[float64] {
 	return m.bounds[i]
 }
 
+// Release releases all of the items in the menu.
+func (m *Menu) Release() {
+	for _, item := range m.items {
+		item.Release()
+	}
+}
+
 func (m *Menu) add(item *MenuItem) {
 	m.items = append(m.items, item)
 	m.bounds = append(m.bounds, geom.Rect[float64]{
-		Max: geom.PConv[float64](item.Size().Add(menuItemInset)),
+		Max: geom.PConv[float64](item.Size().Add(menuItemInset())),
 	})
 }
 
@@ -130,6 +157,17 @@ func (m *Menu) Remove(item *MenuItem) {
 type MenuItem struct {
 	OnSelect func()
 
+	// Submenu, if it isn't nil, creates a menu that is opened next to
+	// the item when it is hovered over. It is called each time that
+	// the submenu is opened, so the menu can reflect the current state
+	// of things, and the menu is released when it is closed. A nil
+	// menu means that there is nothing to show.
+	Submenu func() *Menu
+
+	// Label is the text of the item, if it has any. Typing into an open
+	// menu narrows it down to the items whose labels match.
+	Label string
+
 	active   wlr.Texture
 	inactive wlr.Texture
 }
@@ -146,10 +184,12 @@ func NewMenuItem(active, inactive wlr.Texture) *MenuItem {
 }
 
 func NewTextMenuItem(renderer wlr.Renderer, text string) *MenuItem {
-	return NewMenuItem(
+	item := NewMenuItem(
 		draw.CreateTextTexture(renderer, image.White, text),
 		draw.CreateTextTexture(renderer, image.Black, text),
 	)
+	item.Label = text
+	return item
 }
 
 func (item *MenuItem) Size() geom.Point[int] {
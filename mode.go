@@ -3,20 +3,33 @@ package main
 import (
 	"math"
 	"slices"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"deedles.dev/wlr"
+	"deedles.dev/wlr/xkb"
 	"deedles.dev/ximage/geom"
 )
 
 type InputMode any
 
+// A Releaser is an input mode that holds resources which need to be
+// released when it ends.
+type Releaser interface {
+	Release()
+}
+
 type inputModeNormal struct {
 	inView    bool
 	prevEdges wlr.Edges
 }
 
 func (server *Server) startNormal() {
+	if m, ok := server.inputMode.(Releaser); ok {
+		m.Release()
+	}
+
 	server.setCursor("left_ptr")
 	server.inputMode = &inputModeNormal{}
 }
@@ -26,9 +39,16 @@ func (m *inputModeNormal) CursorMoved(server *Server, t time.Time) {
 
 	view, edges, surface, sp := server.viewAt(nil, cc)
 	if edges != m.prevEdges {
+		// Tiles only get a resize cursor on the edges that their
+		// layout can actually move.
+		movable := edges
+		if server.isViewTiled(view) {
+			movable = server.tileResizeEdges(view, edges)
+		}
+
 		cursor := interactCursor
-		if !server.isViewTiled(view) {
-			cursor = edgeCursors[edges]
+		if (edges == wlr.EdgeNone) || (movable != wlr.EdgeNone) {
+			cursor = edgeCursors[movable]
 			m.prevEdges = edges
 		}
 		server.setCursor(cursor)
@@ -52,7 +72,7 @@ func (m *inputModeNormal) CursorButtonPressed(server *Server, dev wlr.Pointer, b
 	forceMenu := server.seat.GetKeyboard().GetModifiers()&wlr.KeyboardModifierLogo != 0
 	if !forceMenu {
 		out := server.outputAt(cc)
-		forceMenu = (out == server.statusBar.Output()) && (cc.Y <= StatusBarHeight)
+		forceMenu = (out == server.statusBar.Output()) && (server.fullscreenViewOn(out) == nil) && (cc.Y <= StatusBarHeight)
 	}
 	if forceMenu {
 		switch b {
@@ -81,8 +101,11 @@ func (m *inputModeNormal) CursorButtonPressed(server *Server, dev wlr.Pointer, b
 	default:
 		switch b {
 		case wlr.BtnLeft:
-			if !server.isViewTiled(view) {
+			switch movable := server.tileResizeEdges(view, edges); {
+			case !server.isViewTiled(view):
 				server.startBorderResize(view, edges)
+			case movable != wlr.EdgeNone:
+				server.startTileResize(view, movable)
 			}
 		case wlr.BtnRight:
 			server.startMove(view)
@@ -104,6 +127,13 @@ type inputModeMove struct {
 }
 
 func (server *Server) startMove(view *View) {
+	// Fullscreen views stay where they are, as they do when moved over
+	// IPC.
+	if view.Fullscreen != nil {
+		server.startNormal()
+		return
+	}
+
 	server.setCursor("grabbing")
 	server.focusView(view, view.Surface())
 
@@ -118,11 +148,31 @@ func (m *inputModeMove) CursorMoved(server *Server, t time.Time) {
 	cc := server.cursorCoords()
 
 	if server.isViewTiled(m.view) {
+		vi := slices.Index(server.tiled, m.view)
+
 		i, _, _, _ := server.viewIndexAt(nil, server.tiled, cc)
 		if i >= 0 {
-			vi := slices.Index(server.tiled, m.view)
+			// The two tiles trade places, so each output keeps the
+			// same number of tiles and the weights stay with the
+			// places rather than the views.
+			other := server.tiled[i]
 			server.tiled[i], server.tiled[vi] = server.tiled[vi], server.tiled[i]
+			m.view.TiledOn, other.TiledOn = other.TiledOn, m.view.TiledOn
 			server.layoutTiles(nil)
+			return
+		}
+
+		// Dragging a tile onto empty space on another output moves it
+		// to the end of that output's tiles.
+		out := server.outputAt(cc)
+		if (out != nil) && (out != m.view.TiledOn) {
+			prev := m.view.TiledOn
+			server.removeTileWeight(server.workspace, server.tiled, m.view)
+			server.tiled = append(slices.Delete(server.tiled, vi, vi+1), m.view)
+			m.view.TiledOn = out
+			server.insertTileWeight(m.view)
+			server.layoutTiles(prev)
+			server.layoutTiles(out)
 		}
 		return
 	}
@@ -236,18 +286,107 @@ func (m *inputModeBorderResize) TargetView() *View {
 	return m.view
 }
 
+type inputModeTileResize struct {
+	view  *View
+	edges wlr.Edges
+}
+
+func (server *Server) startTileResize(view *View, edges wlr.Edges) {
+	server.setCursor(edgeCursors[edges])
+	server.inputMode = &inputModeTileResize{
+		view:  view,
+		edges: edges,
+	}
+}
+
+func (m *inputModeTileResize) CursorMoved(server *Server, t time.Time) {
+	if !server.isViewTiled(m.view) {
+		server.startNormal()
+		return
+	}
+
+	server.resizeTile(m.view, m.edges, server.cursorCoords())
+}
+
+func (m *inputModeTileResize) CursorButtonReleased(server *Server, dev wlr.Pointer, b wlr.CursorButton, t time.Time) {
+	server.startNormal()
+}
+
+func (m *inputModeTileResize) TargetView() *View {
+	return m.view
+}
+
+// A menuLevel is one of the menus in an open stack of menus. The
+// first is the one that was opened and each of the others is a
+// submenu of an item in the one before it.
+type menuLevel struct {
+	m      *Menu
+	p      geom.Point[float64]
+	sel    *MenuItem
+	filter string
+}
+
+// shown returns the items of the menu that match the filter that has
+// been typed so far.
+func (l *menuLevel) shown() *Menu {
+	return l.filtered(l.filter)
+}
+
+func (l *menuLevel) filtered(filter string) *Menu {
+	if filter == "" {
+		return l.m
+	}
+
+	filter = strings.ToLower(filter)
+	return l.m.Filter(func(item *MenuItem) bool {
+		return strings.Contains(strings.ToLower(item.Label), filter)
+	})
+}
+
+// setFilter narrows the menu down to the items matching filter. If
+// there aren't any, the filter is left as it was.
+func (l *menuLevel) setFilter(filter string) {
+	shown := l.filtered(filter)
+	if shown.Len() == 0 {
+		return
+	}
+
+	l.filter = filter
+	if shown.Index(l.sel) < 0 {
+		l.sel = shown.Item(0)
+	}
+}
+
+// move moves the selection by dir through the shown items, wrapping
+// around at the ends.
+func (l *menuLevel) move(dir int) {
+	shown := l.shown()
+	i := shown.Index(l.sel)
+	if i < 0 {
+		i = min(dir, 0)
+	} else {
+		i += dir
+	}
+	l.sel = shown.Item((i + shown.Len()) % shown.Len())
+}
+
+func (l *menuLevel) bounds() geom.Rect[float64] {
+	return l.shown().Bounds().Add(l.p)
+}
+
 type inputModeMenu struct {
-	m   *Menu
-	p   geom.Point[float64]
-	sel *MenuItem
-	btn wlr.CursorButton
+	levels []*menuLevel
+	btn    wlr.CursorButton
 }
 
+// startMenu opens m under the cursor. The menu is operated by
+// releasing btn over an item, or, if btn is zero, by clicking one.
+// Either way, it can also be operated with the keyboard.
 func (server *Server) startMenu(m *Menu, btn wlr.CursorButton) {
 	cc := server.cursorCoords()
 	ob := server.outputBounds(server.outputAt(cc)).Inset(2 * WindowBorder)
 
-	ib := m.ItemBounds(server.mainMenu.Prev())
+	ib := m.ItemBounds(m.Prev())
 	if ib.IsZero() {
 		ib = m.ItemBounds(m.Item(0))
 	}
@@ -255,30 +394,148 @@ func (server *Server) startMenu(m *Menu, btn wlr.CursorButton) {
 	mb = mb.ClosestIn(ob)
 
 	mode := inputModeMenu{
-		m:   m,
-		p:   mb.Min,
-		btn: btn,
+		levels: []*menuLevel{{m: m, p: mb.Min}},
+		btn:    btn,
 	}
 	mode.CursorMoved(server, time.Now())
 	server.inputMode = &mode
 }
 
+// top returns the most recently opened submenu, or the menu itself if
+// no submenus are open.
+func (m *inputModeMenu) top() *menuLevel {
+	return m.levels[len(m.levels)-1]
+}
+
+// levelAt returns the index of the topmost open menu under p, or -1
+// if there isn't one.
+func (m *inputModeMenu) levelAt(p geom.Point[float64]) int {
+	for i := len(m.levels) - 1; i >= 0; i-- {
+		if p.In(m.levels[i].bounds()) {
+			return i
+		}
+	}
+	return -1
+}
+
+// openSubmenu opens the submenu of the selected item of the top menu
+// next to the item. It returns false if the item doesn't have one.
+func (m *inputModeMenu) openSubmenu(server *Server) bool {
+	l := m.top()
+	if (l.sel == nil) || (l.sel.Submenu == nil) {
+		return false
+	}
+	sub := l.sel.Submenu()
+	if sub == nil {
+		return false
+	}
+
+	ob := server.outputBounds(server.outputAt(server.cursorCoords())).Inset(2 * WindowBorder)
+	ib := l.shown().ItemBounds(l.sel).Add(l.p)
+	mb := sub.Bounds().Add(geom.Pt(ib.Max.X+WindowBorder, ib.Min.Y))
+	mb = mb.ClosestIn(ob)
+
+	m.levels = append(m.levels, &menuLevel{m: sub, p: mb.Min})
+	return true
+}
+
+// closeAbove closes the submenus above the menu at index i.
+func (m *inputModeMenu) closeAbove(i int) {
+	for _, l := range m.levels[i+1:] {
+		l.m.Release()
+	}
+	clear(m.levels[i+1:])
+	m.levels = m.levels[:i+1]
+}
+
+// choose closes the menus and selects the selected item of l.
+func (m *inputModeMenu) choose(server *Server, l *menuLevel) {
+	server.startNormal()
+	l.m.Select(l.sel)
+}
+
 func (m *inputModeMenu) CursorMoved(server *Server, t time.Time) {
-	cc := server.cursorCoords().Sub(m.p)
-	m.sel = m.m.ItemAt(cc)
+	cc := server.cursorCoords()
+	i := m.levelAt(cc)
+	if i < 0 {
+		m.top().sel = nil
+		return
+	}
+
+	l := m.levels[i]
+	item := l.shown().ItemAt(cc.Sub(l.p))
+	if item == l.sel {
+		return
+	}
+
+	m.closeAbove(i)
+	l.sel = item
+	m.openSubmenu(server)
 }
 
 func (m *inputModeMenu) CursorButtonReleased(server *Server, dev wlr.Pointer, b wlr.CursorButton, t time.Time) {
-	if b != m.btn {
+	if (m.btn != 0) && (b != m.btn) {
 		return
 	}
 
-	server.startNormal()
-	m.m.Select(m.sel)
+	i := m.levelAt(server.cursorCoords())
+	if i < 0 {
+		server.startNormal()
+		return
+	}
+	m.choose(server, m.levels[i])
+}
+
+func (m *inputModeMenu) KeyPressed(server *Server, syms []xkb.KeySym, t time.Time) bool {
+	for _, sym := range syms {
+		l := m.top()
+		switch sym {
+		case xkb.KeySymEscape, xkb.KeySymLeft:
+			if len(m.levels) > 1 {
+				m.closeAbove(len(m.levels) - 2)
+				continue
+			}
+			if sym == xkb.KeySymEscape {
+				server.startNormal()
+				return true
+			}
+		case xkb.KeySymReturn, xkb.KeySymKP_Enter:
+			if m.openSubmenu(server) {
+				m.top().move(1)
+				continue
+			}
+			m.choose(server, l)
+			return true
+		case xkb.KeySymRight:
+			if m.openSubmenu(server) {
+				m.top().move(1)
+			}
+		case xkb.KeySymDown, xkb.KeySymTab:
+			l.move(1)
+		case xkb.KeySymUp, xkb.KeySymISO_Left_Tab:
+			l.move(-1)
+		case xkb.KeySymBackSpace:
+			_, size := utf8.DecodeLastRuneInString(l.filter)
+			l.setFilter(l.filter[:len(l.filter)-size])
+		default:
+			if r, ok := keySymRune(sym); ok {
+				l.setFilter(l.filter + string(r))
+			}
+		}
+	}
+	return true
 }
 
 func (m *inputModeMenu) Frame(server *Server, out *Output) {
-	server.renderMenu(out, m.m, m.p, m.sel)
+	for _, l := range m.levels {
+		server.renderMenu(out, l.shown(), l.p, l.sel)
+	}
+}
+
+// Release releases the open submenus. The menu itself belongs to
+// whatever opened it.
+func (m *inputModeMenu) Release() {
+	m.closeAbove(0)
 }
 
 type inputModeSelectView struct {
@@ -376,14 +633,21 @@ func (m *inputModeResize) TargetView() *View {
 }
 
 type inputModeNew struct {
+	start    func(*geom.Rect[float64])
 	n        geom.Rect[float64]
 	dragging bool
 	started  bool
 }
 
 func (server *Server) startNew() {
+	server.startSweep(server.exec)
+}
+
+// startSweep lets a rectangle be swept out with the right mouse
+// button and calls start with it as soon as it is big enough.
+func (server *Server) startSweep(start func(*geom.Rect[float64])) {
 	server.setCursor("top_left_corner")
-	server.inputMode = &inputModeNew{}
+	server.inputMode = &inputModeNew{start: start}
 }
 
 func (m *inputModeNew) CursorMoved(server *Server, t time.Time) {
@@ -402,7 +666,7 @@ func (m *inputModeNew) CursorMoved(server *Server, t time.Time) {
 	}
 
 	if !m.started {
-		server.exec(&m.n)
+		m.start(&m.n)
 		m.started = true
 	}
 }
@@ -433,3 +697,155 @@ func (m *inputModeNew) Frame(server *Server, out *Output) {
 
 	server.renderSelectionBox(out, m.n)
 }
+
+type inputModeOverview struct {
+	hover *View
+}
+
+func (server *Server) startOverview() {
+	server.setCursor("hand1")
+	mode := inputModeOverview{}
+	mode.CursorMoved(server, time.Now())
+	server.inputMode = &mode
+}
+
+func (m *inputModeOverview) CursorMoved(server *Server, t time.Time) {
+	cc := server.cursorCoords()
+
+	m.hover = nil
+	for view, r := range server.overviewThumbnails(server.outputAt(cc)) {
+		if cc.In(r) {
+			m.hover = view
+			return
+		}
+	}
+}
+
+func (m *inputModeOverview) CursorButtonReleased(server *Server, dev wlr.Pointer, b wlr.CursorButton, t time.Time) {
+	server.startNormal()
+
+	view := m.hover
+	if (view == nil) || !view.Mapped() {
+		return
+	}
+	if server.isViewHidden(view) {
+		server.unhideView(view)
+		return
+	}
+	server.focusView(view, view.Surface())
+}
+
+func (m *inputModeOverview) KeyPressed(server *Server, syms []xkb.KeySym, t time.Time) bool {
+	if slices.Contains(syms, xkb.KeySymEscape) {
+		server.startNormal()
+	}
+	return true
+}
+
+func (m *inputModeOverview) Frame(server *Server, out *Output) {
+	ob := server.outputBounds(out)
+	server.renderer.RenderRect(ob.ImageRect(), ColorBackground, out.Output.TransformMatrix())
+
+	for view, r := range server.overviewThumbnails(out) {
+		color := ColorInactiveBorder
+		if view == m.hover {
+			color = ColorSelectionBox
+		}
+		server.renderRectBorder(out, r.Inset(-WindowBorder), color)
+		server.renderViewThumbnail(out, view, r)
+	}
+}
+
+type inputModeSwitcher struct {
+	out   *Output
+	views []*View
+	menu  *Menu
+	sel   int
+}
+
+// startSwitcher shows a list of the views on the current workspace in
+// the order that they were last focused and starts moving through it
+// in the direction of dir. The selected view is focused once all
+// modifiers are released.
+func (server *Server) startSwitcher(dir int) {
+	views := server.mruViews()
+	if len(views) == 0 {
+		return
+	}
+
+	items := func(yield func(*MenuItem) bool) {
+		for _, view := range views {
+			if !yield(NewTextMenuItem(server.renderer, viewLabel(view))) {
+				return
+			}
+		}
+	}
+
+	mode := inputModeSwitcher{
+		out:   server.currentOutput(),
+		views: views,
+		menu:  NewMenuFromSeq(items, len(views)),
+	}
+	mode.move(dir)
+	server.inputMode = &mode
+}
+
+// move moves the selection by dir, wrapping around at the ends. The
+// list starts with the focused view, so the first move selects the
+// one that was focused before it.
+func (m *inputModeSwitcher) move(dir int) {
+	m.sel = (m.sel + dir + len(m.views)) % len(m.views)
+}
+
+func (m *inputModeSwitcher) finish(server *Server) {
+	view := m.views[m.sel]
+	server.startNormal()
+
+	if view.Mapped() && (server.workspaceOf(view) == server.workspace) {
+		server.focusView(view, view.Surface())
+	}
+}
+
+func (m *inputModeSwitcher) KeyPressed(server *Server, syms []xkb.KeySym, t time.Time) bool {
+	for _, sym := range syms {
+		switch sym {
+		case xkb.KeySymTab, xkb.KeySymRight, xkb.KeySymDown:
+			m.move(1)
+		case xkb.KeySymISO_Left_Tab, xkb.KeySymLeft, xkb.KeySymUp:
+			m.move(-1)
+		case xkb.KeySymReturn:
+			m.finish(server)
+		case xkb.KeySymEscape:
+			server.startNormal()
+		}
+	}
+	return true
+}
+
+func (m *inputModeSwitcher) ModifiersChanged(server *Server, mods wlr.KeyboardModifier) {
+	if mods&^(ignoredModifiers|wlr.KeyboardModifierShift) == 0 {
+		m.finish(server)
+	}
+}
+
+func (m *inputModeSwitcher) CursorButtonPressed(server *Server, dev wlr.Pointer, b wlr.CursorButton, t time.Time) {
+	server.startNormal()
+}
+
+func (m *inputModeSwitcher) Frame(server *Server, out *Output) {
+	if out != m.out {
+		return
+	}
+
+	mb := m.menu.Bounds()
+	p := mb.CenterAt(server.outputBounds(out).Center()).Min
+	server.renderMenu(out, m.menu, p, m.menu.Item(m.sel))
+}
+
+func (m *inputModeSwitcher) TargetView() *View {
+	return m.views[m.sel]
+}
+
+func (m *inputModeSwitcher) Release() {
+	m.menu.Release()
+}
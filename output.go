@@ -1,6 +1,9 @@
 package main
 
 import (
+	"slices"
+
+	"deedles.dev/kawa/internal/ipc"
 	"deedles.dev/wlr"
 	"deedles.dev/ximage/geom"
 )
@@ -9,7 +12,22 @@ type Output struct {
 	Output wlr.Output
 	Layers [4][]LayerSurface
 
-	onFrameListener wlr.Listener
+	// Layout arranges the views that are tiled on the output.
+	Layout  Layout
+	TileGap float64
+
+	// layoutStates holds the state of each layout, by name, separately
+	// for every workspace, as each workspace has its own tiles.
+	layoutStates [NumWorkspaces]map[string]*LayoutState
+
+	// poweredOff is whether the output has been turned off on request.
+	// If wakeOnInput is set, it is turned back on by the next input
+	// event.
+	poweredOff  bool
+	wakeOnInput bool
+
+	onFrameListener   wlr.Listener
+	onDestroyListener wlr.Listener
 }
 
 type OutputConfig struct {
@@ -18,6 +36,7 @@ type OutputConfig struct {
 	Width, Height int
 	Scale         float32
 	Transform     wlr.OutputTransform
+	Layout        string
 }
 
 func (server *Server) outputAt(p geom.Point[float64]) *Output {
@@ -50,53 +69,218 @@ func (server *Server) statusBarBounds() geom.Rect[float64] {
 }
 
 func (server *Server) onNewOutput(wout wlr.Output) {
+	// The gap is only set here so that adjusting it on the output
+	// survives the output being reconfigured.
 	out := Output{
-		Output: wout,
+		Output:  wout,
+		TileGap: server.TileGap,
 	}
 	out.onFrameListener = wout.OnFrame(func(wout wlr.Output) {
 		server.onFrame(&out)
 	})
+	out.onDestroyListener = wout.OnDestroy(func(wout wlr.Output) {
+		server.onDestroyOutput(&out)
+	})
 	server.addOutput(&out)
 
 	if server.statusBar == nil {
 		server.statusBar = NewStatusBar(&out)
+		server.updateWorkspace()
+	}
+	if server.statusBar.Output() == nil {
+		server.statusBar.SetOutput(&out)
 	}
 
 	wout.InitRender(server.allocator, server.renderer)
 	wout.Commit()
 	wout.CreateGlobal()
+
+	server.layoutTiles(nil)
+
+	server.emitOutput(ipc.EventOutputNew, &out)
+}
+
+func (server *Server) onDestroyOutput(out *Output) {
+	out.onFrameListener.Destroy()
+	out.onDestroyListener.Destroy()
+
+	i := slices.Index(server.outputs, out)
+	if i >= 0 {
+		server.outputs = slices.Delete(server.outputs, i, i+1)
+	}
+
+	var first *Output
+	if len(server.outputs) != 0 {
+		first = server.outputs[0]
+	}
+	if server.statusBar.Output() == out {
+		server.statusBar.SetOutput(first)
+	}
+
+	for _, view := range slices.Clone(server.views) {
+		if view.Fullscreen == out {
+			server.unfullscreenView(view)
+		}
+	}
+	for _, view := range server.otherWorkspaceViews() {
+		if view.Fullscreen == out {
+			view.Fullscreen = nil
+			view.SetMaximized(false)
+			server.resizeViewTo(nil, view, view.fullscreenRestore)
+		}
+	}
+
+	// Tiles on the output are moved to another one by layoutTiles.
+	server.layoutTiles(nil)
+	server.rehomeViews()
+
+	// The output is already on its way out of the layout, so only its
+	// name is sent.
+	server.emit(ipc.Event{
+		Type:   ipc.EventOutputDestroy,
+		Output: &ipc.Output{Name: out.Output.Name()},
+	})
 }
 
 func (server *Server) addOutput(out *Output) {
 	server.outputs = append(server.outputs, out)
+	server.configureOutput(out, server.outputConfig(out))
+}
 
-	for _, config := range server.OutputConfigs {
-		if config.Name != out.Output.Name() {
-			continue
+// outputConfig returns the configuration for out, or nil if there
+// isn't one.
+func (server *Server) outputConfig(out *Output) *OutputConfig {
+	for i, config := range server.OutputConfigs {
+		if config.Name == out.Output.Name() {
+			return &server.OutputConfigs[i]
 		}
-
-		server.configureOutput(out, &config)
-		return
 	}
-
-	server.configureOutput(out, nil)
+	return nil
 }
 
 func (server *Server) configureOutput(out *Output, config *OutputConfig) {
 	server.setOutputMode(out, config)
 	server.layoutOutput(out, config)
-	out.Output.Enable(true)
+	out.Output.Enable(!out.poweredOff && !server.idle)
+
+	// These are set even without a config so that a reload can undo
+	// a previous config.
+	scale, transform := float32(1), wlr.OutputTransformNormal
+	if config != nil {
+		if config.Scale != 0 {
+			scale = config.Scale
+		}
+		transform = config.Transform
+	}
+	out.Output.SetScale(scale)
+	out.Output.SetTransform(transform)
 
-	if config == nil {
+	layout := server.Layout
+	if (config != nil) && (config.Layout != "") {
+		layout = config.Layout
+	}
+	out.Layout = layoutByName(layout)
+	if out.Layout == nil {
+		out.Layout = layoutGrid{}
+	}
+	for i := range out.layoutStates {
+		if out.layoutStates[i] == nil {
+			out.layoutStates[i] = make(map[string]*LayoutState)
+		}
+	}
+}
+
+// reconfigureOutput applies config to out while kawa is running. The
+// views on the output move along with it, and any that end up off of
+// every output are brought back onto one.
+func (server *Server) reconfigureOutput(out *Output, config *OutputConfig) {
+	old := server.outputBounds(out)
+	views := slices.Concat(server.views, server.otherWorkspaceViews())
+	floating := slices.DeleteFunc(slices.Clone(views), func(view *View) bool {
+		return (view.TiledOn != nil) || (view.Fullscreen != nil) || (server.outputAt(view.Bounds().Center()) != out)
+	})
+
+	server.configureOutput(out, config)
+	out.Output.Commit()
+
+	ob := server.outputBounds(out)
+	d := ob.Min.Sub(old.Min)
+	for _, view := range floating {
+		server.moveViewTo(out, view, view.Coords.Add(d))
+	}
+	for _, view := range views {
+		if view.Fullscreen == out {
+			view.fullscreenRestore = view.fullscreenRestore.Add(d)
+			server.resizeViewTo(out, view, ob)
+		}
+	}
+
+	server.layoutTiles(nil)
+	server.rehomeViews()
+
+	server.emitOutput(ipc.EventOutputChange, out)
+}
+
+// setOutputPower turns out on or off. An output that is turned off
+// stays in the layout, so nothing moves, but it stops rendering. If
+// wake is true, it is turned back on by the next input event.
+func (server *Server) setOutputPower(out *Output, on, wake bool) {
+	out.poweredOff = !on
+	out.wakeOnInput = !on && wake
+
+	out.Output.Enable(on && !server.idle)
+	out.Output.Commit()
+	server.emitOutput(ipc.EventOutputChange, out)
+}
+
+// currentOutputConfig returns a config that describes out as it is
+// now.
+func (server *Server) currentOutputConfig(out *Output) OutputConfig {
+	ob := server.outputBounds(out)
+	return OutputConfig{
+		Name:      out.Output.Name(),
+		X:         int(ob.Min.X),
+		Y:         int(ob.Min.Y),
+		Width:     out.Output.Width(),
+		Height:    out.Output.Height(),
+		Scale:     out.Output.Scale(),
+		Transform: out.Output.Transform(),
+		Layout:    out.Layout.Name(),
+	}
+}
+
+// setOutputConfig replaces the config for the output that config
+// names, or adds it if there isn't one.
+func (server *Server) setOutputConfig(config OutputConfig) {
+	i := slices.IndexFunc(server.OutputConfigs, func(c OutputConfig) bool { return c.Name == config.Name })
+	if i < 0 {
+		server.OutputConfigs = append(server.OutputConfigs, config)
 		return
 	}
+	server.OutputConfigs[i] = config
+}
 
-	if config.Scale != 0 {
-		out.Output.SetScale(config.Scale)
+// hasMode reports whether out supports a mode of the given size.
+func hasMode(out *Output, width, height int) bool {
+	for mode := range out.Output.Modes() {
+		if (mode.Width() == int32(width)) && (mode.Height() == int32(height)) {
+			return true
+		}
 	}
+	return false
+}
 
-	if config.Transform != 0 {
-		out.Output.SetTransform(config.Transform)
+// rehomeViews moves floating views that aren't on any output onto the
+// first one so that they can still be reached.
+func (server *Server) rehomeViews() {
+	if len(server.outputs) == 0 {
+		return
+	}
+
+	for _, view := range slices.Concat(server.views, server.otherWorkspaceViews(), server.hidden) {
+		if (view.TiledOn == nil) && (server.outputAt(view.Bounds().Center()) == nil) {
+			server.centerViewOnOutput(server.outputs[0], view)
+		}
 	}
 }
 
@@ -113,6 +297,9 @@ func (server *Server) setOutputMode(out *Output, config *OutputConfig) {
 	if (config == nil) || (config.Width == 0) || (config.Height == 0) {
 		return
 	}
+	if (out.Output.Width() == config.Width) && (out.Output.Height() == config.Height) {
+		return
+	}
 
 	modes := out.Output.Modes()
 	for mode := range modes {
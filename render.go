@@ -31,8 +31,9 @@ func (server *Server) onFrame(out *Output) {
 	server.renderViews(out)
 	server.renderNewViews(out)
 	server.renderLayer(out, wlr.LayerShellV1LayerTop)
+	server.renderFullscreenViews(out)
 	server.renderLayer(out, wlr.LayerShellV1LayerOverlay)
-	if server.statusBar.Output() == out {
+	if (server.statusBar.Output() == out) && (server.fullscreenViewOn(out) == nil) {
 		server.renderStatusBar()
 	}
 	server.renderMode(out)
@@ -66,7 +67,7 @@ func (server *Server) renderViews(out *Output) {
 	}
 
 	for _, view := range server.views {
-		if !view.Mapped() {
+		if !view.Mapped() || (view.Fullscreen != nil) {
 			continue
 		}
 
@@ -74,6 +75,16 @@ func (server *Server) renderViews(out *Output) {
 	}
 }
 
+func (server *Server) renderFullscreenViews(out *Output) {
+	for _, view := range server.views {
+		if !view.Mapped() || (view.Fullscreen == nil) {
+			continue
+		}
+
+		server.renderViewSurfaces(out, view)
+	}
+}
+
 func (server *Server) renderView(out *Output, view *View) {
 	if !view.CSD {
 		server.renderViewBorder(out, view)
@@ -101,6 +112,29 @@ func (server *Server) renderViewSurfaces(out *Output, view *View) {
 	}
 }
 
+// renderViewThumbnail renders the surfaces of view scaled down to fit
+// into r.
+func (server *Server) renderViewThumbnail(out *Output, view *View, r geom.Rect[float64]) {
+	vb := view.Bounds()
+	scale := r.Dx() / vb.Dx()
+
+	for s := range view.Surfaces() {
+		texture := s.Surface.GetTexture()
+		if !texture.Valid() {
+			continue
+		}
+
+		sb := geom.RConv[float64](surfaceBounds(s.Surface))
+		sb = sb.Add(view.Coords).Add(geom.Pt(float64(s.X), float64(s.Y))).Sub(vb.Min)
+		sb = geom.Rt(sb.Min.X*scale, sb.Min.Y*scale, sb.Max.X*scale, sb.Max.Y*scale).Add(r.Min)
+
+		tr := s.Surface.Current().Transform().Invert()
+		m := wlr.ProjectBoxMatrix(sb.ImageRect(), tr, 0, out.Output.TransformMatrix())
+		server.renderer.RenderTextureWithMatrix(texture, m, 1)
+		s.Surface.SendFrameDone(time.Now())
+	}
+}
+
 func (server *Server) renderNewViews(out *Output) {
 	for _, nv := range server.newViews {
 		server.renderSelectionBox(out, *nv)
@@ -146,13 +180,33 @@ func (server *Server) renderStatusBar() {
 	b := server.statusBarBounds()
 	server.renderer.RenderRect(b.ImageRect(), ColorMenuBorder, tm)
 
+	left := WindowBorder
+	if ws := server.statusBar.Workspace(); ws.Valid() {
+		wb := geom.Rt(0, 0, float64(ws.Width())+2*WindowBorder, b.Dy()).Add(b.Min)
+		server.renderer.RenderRect(wb.ImageRect(), ColorMenuSelected, tm)
+
+		tb := geom.Rt(0, 0, float64(ws.Width()), float64(ws.Height())).CenterAt(wb.Center())
+		m := wlr.ProjectBoxMatrix(tb.ImageRect(), wlr.OutputTransformNormal, 0, tm)
+		server.renderer.RenderTextureWithMatrix(ws, m, 1)
+
+		left += wb.Dx()
+	}
+
 	if title := server.statusBar.Title(); title.Valid() {
 		tb := geom.Rt(0, 0, float64(title.Width()), float64(title.Height()))
 		tb = geom.Align(b, tb, geom.EdgeLeft)
-		tb = tb.Add(geom.Pt[float64](WindowBorder, 0))
+		tb = tb.Add(geom.Pt(left, 0))
 		m := wlr.ProjectBoxMatrix(tb.ImageRect(), wlr.OutputTransformNormal, 0, tm)
 		server.renderer.RenderTextureWithMatrix(title, m, 1)
 	}
+
+	if msg := server.statusBar.Message(); msg.Valid() {
+		mb := geom.Rt(0, 0, float64(msg.Width()), float64(msg.Height()))
+		mb = geom.Align(b, mb, geom.EdgeRight)
+		mb = mb.Sub(geom.Pt[float64](WindowBorder, 0))
+		m := wlr.ProjectBoxMatrix(mb.ImageRect(), wlr.OutputTransformNormal, 0, tm)
+		server.renderer.RenderTextureWithMatrix(msg, m, 1)
+	}
 }
 
 func (server *Server) renderMode(out *Output) {
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"cmp"
 	"image"
+	"net"
 	"os"
 	"os/exec"
+	"slices"
 	"strings"
+	"time"
 
 	"deedles.dev/wlr"
 	"deedles.dev/ximage/geom"
@@ -18,9 +22,27 @@ var (
 		"Move",
 		"Close",
 		"Hide",
+		"Overview",
+		"Layout",
+		"Send Next",
+		"Send Prev",
+	}
+
+	mainSubmenuText = []string{
+		"Apps ►",
+		"Hidden ►",
+		"Windows ►",
 	}
 
 	systemMenuText = []string{
+		"Next Workspace",
+		"Prev Workspace",
+		"Reload",
+		"Log Out",
+	}
+
+	exitMenuText = []string{
+		"Cancel",
 		"Log Out",
 	}
 )
@@ -28,6 +50,29 @@ var (
 type Server struct {
 	Terms         []string
 	OutputConfigs []OutputConfig
+	Bindings      []Binding
+	Autostart     []AutostartCommand
+	XDGAutostart  bool
+	MenuCommands  []MenuCommand
+
+	// Layout, MasterRatio and TileGap are the tiling settings that
+	// outputs start with.
+	Layout      string
+	MasterRatio float64
+	TileGap     float64
+
+	// IdleTimeout is how long to wait without any input before turning
+	// the outputs off. Zero means never.
+	IdleTimeout time.Duration
+
+	// ExitTimeout is how long to wait for clients to exit after
+	// logging out before shutting down anyway.
+	ExitTimeout time.Duration
+
+	// LoadConfig loads the configuration, including any overrides
+	// from the command line. It is called again to reload the
+	// configuration while running.
+	LoadConfig func() (*Config, error)
 
 	display wlr.Display
 
@@ -54,16 +99,44 @@ type Server struct {
 	hidden    []*View
 	newViews  map[int]*geom.Rect[float64]
 
+	// workspaces holds the views of the workspaces other than the
+	// current one. workspaces[workspace] is empty.
+	workspaces [NumWorkspaces]Workspace
+	workspace  int
+
+	nextViewID  uint64
+	focusSerial uint64
+
+	autostartProcs map[int]*autostartProc
+
+	// apps are the applications shown in the apps menu. Reading them
+	// means parsing every desktop entry, so it is only done at startup
+	// and when the config is reloaded.
+	apps []desktopApp
+
+	idle      bool
+	idleTimer *time.Timer
+	lastInput time.Time
+
 	bg      wlr.Texture
 	bgScale scaleFunc
 
 	mainMenu   *Menu
 	systemMenu *Menu
+	exitMenu   *Menu
 
 	statusBar *StatusBar
 
 	inputMode InputMode
 
+	ipcListener *net.UnixListener
+	subscribers []*ipcSubscriber
+
+	queue        eventQueue
+	done         bool
+	exiting      bool
+	messageTimer *time.Timer
+
 	onNewOutputListener             wlr.Listener
 	onNewInputListener              wlr.Listener
 	onCursorMotionListener          wlr.Listener
@@ -93,9 +166,13 @@ func (server *Server) Release() {
 	server.onNewLayerSurfaceListener.Destroy()
 	server.onNewDecorationListener.Destroy()
 	server.onNewToplevelDecorationListener.Destroy()
+
+	server.stopIPC()
+	server.queue.close()
 }
 
 func (server *Server) Shutdown() {
+	server.done = true
 	server.display.Terminate()
 }
 
@@ -120,17 +197,52 @@ func (server *Server) loadBG(path string) {
 	wlr.Log(wlr.Info, "loaded %q as background", path)
 }
 
+func (server *Server) setBG(path, scale string) {
+	server.bgScale = scaleFuncs[scale]
+	if path != "" {
+		server.loadBG(path)
+		return
+	}
+
+	if server.bg.Valid() {
+		server.bg.Destroy()
+		server.bg = wlr.Texture{}
+	}
+}
+
+// showMessage shows msg in the status bar for a while. An empty msg
+// clears the current message immediately.
+func (server *Server) showMessage(msg string) {
+	if server.messageTimer != nil {
+		server.messageTimer.Stop()
+		server.messageTimer = nil
+	}
+
+	server.statusBar.SetMessage(server.renderer, msg)
+	if msg == "" {
+		return
+	}
+
+	var timer *time.Timer
+	timer = server.after(MessageTimeout, func() {
+		if server.messageTimer != timer {
+			return
+		}
+		server.messageTimer = nil
+		server.statusBar.SetMessage(server.renderer, "")
+	})
+	server.messageTimer = timer
+}
+
 func (server *Server) exec(to *geom.Rect[float64]) {
 	for _, term := range server.Terms {
 		args := strings.Fields(term)
 		cmd := exec.Command(args[0], args[1:]...) // TODO: Context support?
-		err := cmd.Start()
+		err := server.spawn(cmd, to)
 		if err != nil {
 			wlr.Log(wlr.Error, "start new with %q: %v", term, err)
 			continue
 		}
-
-		server.newViews[cmd.Process.Pid] = to
 		return
 	}
 
@@ -140,6 +252,13 @@ func (server *Server) exec(to *geom.Rect[float64]) {
 func (server *Server) initUI() {
 	server.initMainMenu()
 	server.initSystemMenu()
+	server.initExitMenu()
+}
+
+func (server *Server) releaseUI() {
+	server.mainMenu.Release()
+	server.systemMenu.Release()
+	server.exitMenu.Release()
 }
 
 func (server *Server) initMainMenu() {
@@ -150,6 +269,16 @@ func (server *Server) initMainMenu() {
 		server.onMainMenuMove,
 		server.onMainMenuClose,
 		server.onMainMenuHide,
+		server.onMainMenuOverview,
+		server.actionNextLayout,
+		server.onMainMenuSendNext,
+		server.onMainMenuSendPrev,
+	}
+
+	subs := []func() *Menu{
+		server.appsMenu,
+		server.hiddenMenu,
+		server.windowsMenu,
 	}
 
 	items := func(yield func(*MenuItem) bool) {
@@ -160,9 +289,56 @@ func (server *Server) initMainMenu() {
 				return
 			}
 		}
+		for item := range server.commandMenuItems(MenuMain) {
+			if !yield(item) {
+				return
+			}
+		}
+		for i, text := range mainSubmenuText {
+			item := NewTextMenuItem(server.renderer, text)
+			item.Submenu = subs[i]
+			if !yield(item) {
+				return
+			}
+		}
+	}
+
+	server.mainMenu = NewMenuFromSeq(items, len(mainMenuText)+len(server.MenuCommands)+len(mainSubmenuText))
+}
+
+// hiddenMenu creates a menu of the hidden views.
+func (server *Server) hiddenMenu() *Menu {
+	return server.viewMenu(server.hidden)
+}
+
+// windowsMenu creates a menu of every view on every workspace,
+// including the hidden ones.
+func (server *Server) windowsMenu() *Menu {
+	views := slices.Concat(server.tiled, server.views, server.otherWorkspaceViews(), server.hidden)
+	slices.SortFunc(views, func(v1, v2 *View) int { return cmp.Compare(v1.ID, v2.ID) })
+	return server.viewMenu(views)
+}
+
+// viewMenu creates a menu that brings up the selected one of views.
+// It returns nil if there are no views.
+func (server *Server) viewMenu(views []*View) *Menu {
+	if len(views) == 0 {
+		return nil
+	}
+
+	items := func(yield func(*MenuItem) bool) {
+		for _, view := range views {
+			item := NewTextMenuItem(server.renderer, viewLabel(view))
+			item.OnSelect = func() {
+				server.activateView(view)
+			}
+			if !yield(item) {
+				return
+			}
+		}
 	}
 
-	server.mainMenu = NewMenuFromSeq(items, len(mainMenuText))
+	return NewMenuFromSeq(items, len(views))
 }
 
 func (server *Server) onMainMenuNew() {
@@ -202,8 +378,29 @@ func (server *Server) onMainMenuHide() {
 	})
 }
 
+func (server *Server) onMainMenuOverview() {
+	server.startOverview()
+}
+
+func (server *Server) onMainMenuSendNext() {
+	server.startSelectView(wlr.BtnRight, func(view *View) {
+		server.sendToWorkspace(view, (server.workspace+1)%NumWorkspaces)
+		server.startNormal()
+	})
+}
+
+func (server *Server) onMainMenuSendPrev() {
+	server.startSelectView(wlr.BtnRight, func(view *View) {
+		server.sendToWorkspace(view, (server.workspace+NumWorkspaces-1)%NumWorkspaces)
+		server.startNormal()
+	})
+}
+
 func (server *Server) initSystemMenu() {
 	cbs := []func(){
+		server.actionNextWorkspace,
+		server.actionPrevWorkspace,
+		server.onSystemMenuReload,
 		server.onSystemMenuLogOut,
 	}
 
@@ -215,11 +412,71 @@ func (server *Server) initSystemMenu() {
 				return
 			}
 		}
+		for item := range server.commandMenuItems(MenuSystem) {
+			if !yield(item) {
+				return
+			}
+		}
 	}
 
-	server.systemMenu = NewMenuFromSeq(items, len(systemMenuText))
+	server.systemMenu = NewMenuFromSeq(items, len(systemMenuText)+len(server.MenuCommands))
+}
+
+func (server *Server) onSystemMenuReload() {
+	server.reloadConfig()
 }
 
 func (server *Server) onSystemMenuLogOut() {
-	server.Shutdown()
+	// Logging out is only a single click away from the status bar, so
+	// it needs to be confirmed with a second one.
+	server.startMenu(server.exitMenu, wlr.BtnLeft)
+}
+
+func (server *Server) initExitMenu() {
+	cbs := []func(){
+		func() {},
+		server.logOut,
+	}
+
+	items := func(yield func(*MenuItem) bool) {
+		for i, text := range exitMenuText {
+			item := NewTextMenuItem(server.renderer, text)
+			item.OnSelect = cbs[i]
+			if !yield(item) {
+				return
+			}
+		}
+	}
+
+	server.exitMenu = NewMenuFromSeq(items, len(exitMenuText))
+}
+
+// logOut asks every view to close and then shuts down once they have
+// all been destroyed or ExitTimeout has passed, whichever comes first.
+func (server *Server) logOut() {
+	if server.exiting {
+		return
+	}
+	server.exiting = true
+
+	views := slices.Concat(server.tiled, server.views, server.otherWorkspaceViews(), server.hidden)
+	if len(views) == 0 {
+		server.Shutdown()
+		return
+	}
+
+	wlr.Log(wlr.Info, "logging out: waiting for %v views to close", len(views))
+	server.showMessage("Logging out...")
+	for _, view := range views {
+		server.closeView(view)
+	}
+
+	server.after(server.ExitTimeout, func() {
+		if server.done {
+			return
+		}
+
+		wlr.Log(wlr.Info, "logging out: timed out waiting for views to close")
+		server.Shutdown()
+	})
 }
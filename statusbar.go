@@ -8,8 +8,10 @@ import (
 )
 
 type StatusBar struct {
-	out   *Output
-	title wlr.Texture
+	out       *Output
+	workspace wlr.Texture
+	title     wlr.Texture
+	message   wlr.Texture
 }
 
 func NewStatusBar(out *Output) *StatusBar {
@@ -30,10 +32,43 @@ func (s *StatusBar) SetTitle(r wlr.Renderer, str string) {
 	s.title = draw.CreateTextTexture(r, image.White, str)
 }
 
+func (s *StatusBar) SetWorkspace(r wlr.Renderer, str string) {
+	if s.workspace.Valid() {
+		s.workspace.Destroy()
+	}
+	s.workspace = draw.CreateTextTexture(r, image.White, str)
+}
+
+func (s *StatusBar) SetMessage(r wlr.Renderer, str string) {
+	if s.message.Valid() {
+		s.message.Destroy()
+		s.message = wlr.Texture{}
+	}
+	if str == "" {
+		return
+	}
+
+	s.message = draw.CreateTextTexture(r, image.White, str)
+}
+
+func (s *StatusBar) Message() wlr.Texture {
+	return s.message
+}
+
+func (s *StatusBar) Workspace() wlr.Texture {
+	return s.workspace
+}
+
 func (s *StatusBar) Title() wlr.Texture {
 	return s.title
 }
 
+// SetOutput moves the status bar to out. If out is nil, the status bar
+// isn't shown anywhere.
+func (s *StatusBar) SetOutput(out *Output) {
+	s.out = out
+}
+
 func (s *StatusBar) Output() *Output {
 	return s.out
 }
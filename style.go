@@ -2,6 +2,7 @@ package main
 
 import (
 	"image/color"
+	"time"
 
 	"deedles.dev/ximage/geom"
 )
@@ -10,8 +11,22 @@ const (
 	MinWidth  = 128
 	MinHeight = 24
 
-	WindowBorder    = 5
-	StatusBarHeight = 5 * WindowBorder
+	DefaultWindowBorder = 5
+)
+
+const (
+	MessageTimeout = 10 * time.Second
+
+	DefaultExitTimeout = 5 * time.Second
+
+	// NewViewTimeout is how long to wait for a program to open a
+	// window in a rectangle that was swept out for it.
+	NewViewTimeout = 30 * time.Second
+)
+
+var (
+	WindowBorder    float64 = DefaultWindowBorder
+	StatusBarHeight float64 = 25
 )
 
 var (
@@ -30,6 +45,13 @@ var (
 	DefaultRestore = geom.Rt[float64](0, 0, 640, 480).Add(geom.Pt[float64](10, 10))
 )
 
+var scaleFuncs = map[string]scaleFunc{
+	"stretch": scaleStretch,
+	"center":  scaleCenter,
+	"fit":     scaleFit,
+	"fill":    scaleFill,
+}
+
 type scaleFunc func(out, r geom.Rect[float64]) geom.Rect[float64]
 
 func scaleStretch(out, r geom.Rect[float64]) geom.Rect[float64] {
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"cmp"
 	"fmt"
+	"iter"
+	"math"
 	"slices"
 
+	"deedles.dev/kawa/internal/ipc"
 	"deedles.dev/wlr"
 	"deedles.dev/ximage/geom"
 	"deedles.dev/xiter"
@@ -13,6 +17,18 @@ type ViewTargeter interface {
 	TargetView() *View
 }
 
+// viewPlacement records where a view was so that it can be put back
+// there later.
+type viewPlacement struct {
+	workspace int
+	bounds    geom.Rect[float64]
+
+	// tile is the index of the view in its workspace's tiled views,
+	// or -1 if it wasn't tiled.
+	tile    int
+	tiledOn *Output
+}
+
 var edgeCursors = [...]string{
 	wlr.EdgeNone:                   "",
 	wlr.EdgeTop:                    "top_side",
@@ -32,10 +48,34 @@ const (
 
 type View struct {
 	ViewSurface
+	ID      uint64
 	Coords  geom.Point[float64]
 	Restore geom.Rect[float64]
 	CSD     bool
 
+	// Fullscreen is the output that the view is fullscreen on, or nil
+	// if it isn't fullscreen.
+	Fullscreen *Output
+
+	// TiledOn is the output that the view is tiled on, or nil if it
+	// isn't tiled.
+	TiledOn *Output
+
+	// title is the title of the view as of the last call to
+	// updateTitles.
+	title string
+
+	// fullscreenRestore and fullscreenTiled remember how to put the
+	// view back when it leaves fullscreen.
+	fullscreenRestore geom.Rect[float64]
+	fullscreenTiled   bool
+
+	// hiddenPlacement is where the view was before it was hidden.
+	hiddenPlacement viewPlacement
+
+	// focusSerial orders views by how recently they were focused.
+	focusSerial uint64
+
 	popups []*Popup
 
 	onMapListener             wlr.Listener
@@ -119,6 +159,13 @@ func (server *Server) viewAt(out *Output, p geom.Point[float64]) (*View, wlr.Edg
 		out = server.outputAt(p)
 	}
 
+	if fv := server.fullscreenViewOn(out); (fv != nil) && fv.Mapped() {
+		edges, surface, sp, ok := server.isViewAt(out, fv, p)
+		if ok {
+			return fv, edges, surface, sp
+		}
+	}
+
 	i, edges, surface, sp := server.viewIndexAt(out, server.views, p)
 	if i >= 0 {
 		return server.views[i], edges, surface, sp
@@ -155,7 +202,7 @@ func (server *Server) isViewAt(out *Output, view *View, p geom.Point[float64]) (
 	}
 
 	// Don't bother checking the borders if there aren't any.
-	if view.CSD {
+	if view.CSD || (view.Fullscreen != nil) {
 		return 0, wlr.Surface{}, geom.Point[float64]{}, false
 	}
 
@@ -213,10 +260,13 @@ func (server *Server) onNewXwaylandSurface(surface wlr.XwaylandSurface) {
 		server.onMapView(&view)
 	})
 	view.onRequestMoveListener = surface.OnRequestMove(func(s wlr.XwaylandSurface) {
+		if !server.isViewShown(&view) {
+			return
+		}
 		server.startMove(&view)
 	})
 	view.onRequestResizeListener = surface.OnRequestResize(func(s wlr.XwaylandSurface, edges wlr.Edges) {
-		if !server.isViewTiled(&view) {
+		if server.isViewShown(&view) && !server.isViewTiled(&view) {
 			server.startBorderResize(&view, edges)
 		}
 	})
@@ -224,6 +274,9 @@ func (server *Server) onNewXwaylandSurface(surface wlr.XwaylandSurface) {
 		server.hideView(&view)
 	})
 	view.onRequestMaximizeListener = surface.OnRequestMaximize(func(s wlr.XwaylandSurface) {
+		if !server.isViewShown(&view) {
+			return
+		}
 		server.toggleViewTiling(&view)
 	})
 	view.onSetTitleListener = surface.OnSetTitle(func(s wlr.XwaylandSurface, title string) {
@@ -266,10 +319,13 @@ func (server *Server) addXDGToplevel(surface wlr.XDGSurface) {
 		server.onMapView(&view)
 	})
 	view.onRequestMoveListener = surface.Toplevel().OnRequestMove(func(t wlr.XDGToplevel, client wlr.SeatClient, serial uint32) {
+		if !server.isViewShown(&view) {
+			return
+		}
 		server.startMove(&view)
 	})
 	view.onRequestResizeListener = surface.Toplevel().OnRequestResize(func(t wlr.XDGToplevel, client wlr.SeatClient, serial uint32, edges wlr.Edges) {
-		if !server.isViewTiled(&view) {
+		if server.isViewShown(&view) && !server.isViewTiled(&view) {
 			server.startBorderResize(&view, edges)
 		}
 	})
@@ -277,6 +333,9 @@ func (server *Server) addXDGToplevel(surface wlr.XDGSurface) {
 		server.hideView(&view)
 	})
 	view.onRequestMaximizeListener = surface.Toplevel().OnRequestMaximize(func(t wlr.XDGToplevel) {
+		if !server.isViewShown(&view) {
+			return
+		}
 		server.toggleViewTiling(&view)
 	})
 	view.onSetTitleListener = surface.Toplevel().OnSetTitle(func(t wlr.XDGToplevel, title string) {
@@ -289,27 +348,56 @@ func (server *Server) addXDGToplevel(surface wlr.XDGSurface) {
 func (server *Server) onDestroyView(view *View) {
 	view.Release()
 
+	// The surface is on its way out, so only what's already known
+	// about the view is sent.
+	server.emit(ipc.Event{
+		Type: ipc.EventViewDestroy,
+		View: &ipc.View{ID: view.ID, Title: view.title},
+	})
+
 	i := slices.Index(server.views, view)
 	if i >= 0 {
 		server.views = slices.Delete(server.views, i, i+1)
 	}
 	i = slices.Index(server.tiled, view)
 	if i >= 0 {
+		server.removeTileWeight(server.workspace, server.tiled, view)
 		server.tiled = slices.Delete(server.tiled, i, i+1)
-		server.layoutTiles(nil)
+		server.layoutTiles(view.TiledOn)
+	}
+	i = slices.Index(server.hidden, view)
+	if i >= 0 {
+		server.hidden = slices.Delete(server.hidden, i, i+1)
+	}
+
+	server.removeFromWorkspaces(view)
+
+	if m, ok := server.inputMode.(*inputModeSwitcher); ok && slices.Contains(m.views, view) {
+		server.startNormal()
+	}
+
+	if server.exiting && (len(server.views)+len(server.tiled)+len(server.hidden)+len(server.otherWorkspaceViews()) == 0) {
+		server.Shutdown()
+		return
 	}
 
 	server.updateTitles()
-	allviews := xiter.Concat(slices.Values(server.tiled), slices.Values(server.views))
-	if n, ok := xiter.Drain(allviews); ok {
+	if n, ok := server.topView(); ok {
 		server.focusView(n, n.Surface())
 	}
 }
 
+// topView returns the view at the top of the stack on the current
+// workspace.
+func (server *Server) topView() (*View, bool) {
+	allviews := xiter.Concat(slices.Values(server.tiled), slices.Values(server.views))
+	return xiter.Drain(allviews)
+}
+
 func (server *Server) onMapView(view *View) {
-	pid := view.PID()
+	server.emitView(ipc.EventViewMap, view)
 
-	nv, ok := server.newViews[pid]
+	pid, nv, ok := server.newViewFor(view.PID())
 	if ok {
 		delete(server.newViews, pid)
 		server.startBorderResizeFrom(view, wlr.EdgeNone, *nv)
@@ -328,12 +416,17 @@ func (server *Server) onMapView(view *View) {
 }
 
 func (server *Server) addView(view *View) {
+	server.nextViewID++
+	view.ID = server.nextViewID
+
 	server.views = append(server.views, view)
 
-	nv, ok := server.newViews[view.PID()]
+	_, nv, ok := server.newViewFor(view.PID())
 	if ok {
 		server.resizeViewTo(nil, view, *nv)
 	}
+
+	server.emitView(ipc.EventViewNew, view)
 }
 
 func (server *Server) centerViewOnOutput(out *Output, view *View) {
@@ -395,7 +488,11 @@ func (server *Server) focusView(view *View, s wlr.Surface) {
 	view.SetActivated(true)
 	server.bringViewToFront(view)
 
+	server.focusSerial++
+	view.focusSerial = server.focusSerial
+
 	server.updateTitles()
+	server.emitView(ipc.EventViewFocus, view)
 }
 
 func (server *Server) focusedView() *View {
@@ -423,50 +520,170 @@ func (server *Server) viewForSurface(s wlr.Surface) *View {
 	return nil
 }
 
+func (server *Server) viewByID(id uint64) *View {
+	for _, view := range slices.Concat(server.views, server.tiled, server.otherWorkspaceViews(), server.hidden) {
+		if view.ID == id {
+			return view
+		}
+	}
+	return nil
+}
+
 func (server *Server) bringViewToFront(view *View) {
 	if server.isViewTiled(view) {
+		// Tiles only overlap in the monocle layout, and moving them
+		// around in any other would rearrange them.
+		if view.TiledOn == nil {
+			return
+		}
+		if _, ok := view.TiledOn.Layout.(layoutMonocle); ok {
+			// The other layouts' weights go along with the tiles so
+			// that switching back to one doesn't shuffle their sizes.
+			from := tileIndex(server.tiled, view)
+			i := slices.Index(server.tiled, view)
+			server.tiled = append(slices.Delete(server.tiled, i, i+1), view)
+			server.moveTileWeight(view, from)
+		}
 		return
 	}
 
 	i := slices.Index(server.views, view)
+	if i < 0 {
+		return
+	}
 	server.views = slices.Delete(server.views, i, i+1)
 	server.views = append(server.views, view)
 }
 
 func (server *Server) hideView(view *View) {
-	// TODO: Remember whether or not a hidden view was tiled.
-	if server.isViewTiled(view) {
-		server.untileView(view, true)
+	ws := server.workspaceOf(view)
+	if ws < 0 {
+		return
 	}
-	i := slices.Index(server.views, view)
+
+	var fullscreenOn *Output
+	if view.Fullscreen != nil {
+		if ws == server.workspace {
+			server.unfullscreenView(view)
+		} else {
+			// Views on other workspaces aren't shown, so there's no
+			// need to lay anything out again.
+			fullscreenOn = view.Fullscreen
+			view.Fullscreen = nil
+			view.SetMaximized(false)
+			server.resizeViewTo(nil, view, view.fullscreenRestore)
+		}
+	}
+
+	view.hiddenPlacement = viewPlacement{
+		workspace: ws,
+		bounds:    view.Bounds(),
+		tiledOn:   view.TiledOn,
+	}
+
+	tiled := server.tiled
+	if ws != server.workspace {
+		tiled = server.workspaces[ws].tiled
+	}
+	view.hiddenPlacement.tile = slices.Index(tiled, view)
+	if (fullscreenOn != nil) && view.fullscreenTiled {
+		// It wasn't put back into the tiles when it left fullscreen
+		// above, so it is when it is unhidden instead.
+		view.hiddenPlacement.tile = len(tiled)
+		view.hiddenPlacement.tiledOn = fullscreenOn
+	}
+
+	i := slices.Index(server.tiled, view)
+	if i >= 0 {
+		server.removeTileWeight(server.workspace, server.tiled, view)
+		server.tiled = slices.Delete(server.tiled, i, i+1)
+		server.layoutTiles(view.hiddenPlacement.tiledOn)
+	}
+	i = slices.Index(server.views, view)
 	if i >= 0 {
 		server.views = slices.Delete(server.views, i, i+1)
 	}
+	server.removeFromWorkspaces(view)
+	view.TiledOn = nil
 
 	server.hidden = append(server.hidden, view)
 	view.SetMinimized(true)
 
-	item := NewTextMenuItem(server.renderer, view.Title())
-	item.OnSelect = func() {
+	server.emitView(ipc.EventViewHide, view)
+}
+
+// activateView brings up view wherever it is, unhiding it or
+// switching to its workspace if necessary, and focuses it.
+func (server *Server) activateView(view *View) {
+	if server.isViewHidden(view) {
 		server.unhideView(view)
+		return
+	}
+
+	ws := server.workspaceOf(view)
+	if ws < 0 {
+		// The view was destroyed after the menu was opened.
+		return
+	}
+	server.switchWorkspace(ws)
+
+	if view.Mapped() {
+		server.focusView(view, view.Surface())
+	}
+}
+
+// viewLabel returns the text used to refer to view in menus.
+func viewLabel(view *View) string {
+	title := view.Title()
+	if title == "" {
+		return fmt.Sprintf("View %v", view.ID)
 	}
-	server.mainMenu.Add(item)
+	return title
 }
 
 func (server *Server) unhideView(view *View) {
 	i := slices.Index(server.hidden, view)
 	server.hidden = slices.Delete(server.hidden, i, i+1)
 
-	mi := server.mainMenu.Item(len(mainMenuText) + i)
-	server.mainMenu.Remove(mi)
-	mi.Release()
+	// The view is put back exactly where it was, which may mean
+	// switching to its workspace first.
+	p := view.hiddenPlacement
+	view.hiddenPlacement = viewPlacement{}
+	server.switchWorkspace(p.workspace)
+
+	if p.tile >= 0 {
+		out := p.tiledOn
+		if !slices.Contains(server.outputs, out) {
+			out = server.viewOutput(view)
+		}
+
+		server.tiled = slices.Insert(server.tiled, min(p.tile, len(server.tiled)), view)
+		view.TiledOn = out
+		server.insertTileWeight(view)
+		view.SetMaximized(true)
+		server.layoutTiles(out)
+	} else {
+		server.views = append(server.views, view)
+		if !p.bounds.IsZero() {
+			server.resizeViewTo(nil, view, p.bounds)
+		}
+		if (server.outputAt(view.Bounds().Center()) == nil) && (len(server.outputs) != 0) {
+			server.centerViewOnOutput(server.outputs[0], view)
+		}
+	}
 
-	server.views = append(server.views, view)
 	server.focusView(view, view.Surface())
 	view.SetMinimized(false)
+
+	server.emitView(ipc.EventViewUnhide, view)
 }
 
 func (server *Server) toggleViewTiling(view *View) {
+	if view.Fullscreen != nil {
+		server.unfullscreenView(view)
+		return
+	}
+
 	if server.isViewTiled(view) {
 		server.untileView(view, true)
 		return
@@ -480,8 +697,18 @@ func (server *Server) tileView(view *View) {
 	}
 
 	i := slices.Index(server.views, view)
+	if i < 0 {
+		return
+	}
+
+	out := server.viewOutput(view)
+	if out == nil {
+		return
+	}
+
 	server.views = slices.Delete(server.views, i, i+1)
 	server.tiled = append(server.tiled, view)
+	view.TiledOn = out
 
 	view.Restore = DefaultRestore
 	if s := view.Surface(); s.Valid() {
@@ -489,45 +716,211 @@ func (server *Server) tileView(view *View) {
 	}
 	view.SetMaximized(true) // TODO: Fix the race condition between this and resizing the view.
 
-	server.layoutTiles(nil)
+	server.layoutTiles(out)
 	server.focusView(view, view.Surface())
+
+	server.emitView(ipc.EventViewTile, view)
 }
 
 func (server *Server) untileView(view *View, restore bool) {
+	server.removeTileWeight(server.workspace, server.tiled, view)
 	i := slices.Index(server.tiled, view)
 	server.tiled = slices.Delete(server.tiled, i, i+1)
 	server.views = append(server.views, view)
 
-	server.layoutTiles(nil)
+	out := view.TiledOn
+	view.TiledOn = nil
+	server.layoutTiles(out)
 	server.focusView(view, view.Surface())
 
 	view.SetMaximized(false)
 	if restore && !view.Restore.IsZero() {
 		server.resizeViewTo(nil, view, view.Restore)
 	}
+
+	server.emitView(ipc.EventViewUntile, view)
 }
 
+// layoutTiles lays out the views that are tiled on out. If out is
+// nil, the tiles on every output are laid out, and views that are
+// tiled on an output that no longer exists are moved to another one.
+// If there are no outputs left, they keep pointing at the old one
+// until an output is added and this is called again.
 func (server *Server) layoutTiles(out *Output) {
-	if len(server.tiled) == 0 {
+	if out == nil {
+		for _, view := range server.tiled {
+			if slices.Contains(server.outputs, view.TiledOn) {
+				continue
+			}
+			if out := server.viewOutput(view); out != nil {
+				view.TiledOn = out
+				server.insertTileWeight(view)
+			}
+		}
+		for _, out := range server.outputs {
+			server.layoutTiles(out)
+		}
 		return
 	}
 
-	if out == nil {
-		out = server.outputs[0]
+	if !slices.Contains(server.outputs, out) {
+		return
+	}
+
+	tiled := server.tiledOn(out)
+	if len(tiled) == 0 {
+		return
 	}
 
 	or := server.outputTilingBounds(out)
-	tiles := geom.TiledRows(len(server.tiled), or, 4)
+	tiles := out.Layout.Tiles(len(tiled), or, server.layoutState(out))
 	for i, tile := range xiter.Enumerate(tiles) {
-		tile = tile.Inset(3 * WindowBorder)
-		server.resizeViewTo(out, server.tiled[i], tile)
+		tile = tile.Inset(out.TileGap)
+		server.resizeViewTo(out, tiled[i], tile)
+	}
+}
+
+// tiledOn returns the views that are tiled on out, in order.
+func (server *Server) tiledOn(out *Output) []*View {
+	var tiled []*View
+	for _, view := range server.tiled {
+		if view.TiledOn == out {
+			tiled = append(tiled, view)
+		}
+	}
+	return tiled
+}
+
+// viewOutput returns the output that the center of view is on. If it
+// isn't on any, the first output is returned instead.
+func (server *Server) viewOutput(view *View) *Output {
+	out := server.outputAt(view.Bounds().Center())
+	if (out == nil) && (len(server.outputs) != 0) {
+		out = server.outputs[0]
+	}
+	return out
+}
+
+// overviewThumbnails yields the mapped views, including hidden ones,
+// along with where their thumbnails go in the overview on out. Each
+// view keeps its aspect ratio and is never scaled up.
+func (server *Server) overviewThumbnails(out *Output) iter.Seq2[*View, geom.Rect[float64]] {
+	return func(yield func(*View, geom.Rect[float64]) bool) {
+		if out == nil {
+			return
+		}
+
+		views := slices.Concat(server.tiled, server.views, server.hidden)
+		views = slices.DeleteFunc(views, func(view *View) bool { return !view.Mapped() })
+		if len(views) == 0 {
+			return
+		}
+		slices.SortFunc(views, func(v1, v2 *View) int { return cmp.Compare(v1.ID, v2.ID) })
+
+		cols := int(math.Ceil(math.Sqrt(float64(len(views)))))
+		or := server.outputTilingBounds(out).Inset(3 * WindowBorder)
+		cells := geom.TiledRows(len(views), or, cols)
+		for i, cell := range xiter.Enumerate(cells) {
+			vb := views[i].Bounds()
+			if vb.Empty() {
+				continue
+			}
+
+			r := scaleFit(cell.Inset(3*WindowBorder), vb.Sub(vb.Min))
+			r = r.CenterAt(cell.Center())
+			if !yield(views[i], r) {
+				return
+			}
+		}
 	}
 }
 
+func (server *Server) toggleViewFullscreen(view *View) {
+	if view.Fullscreen != nil {
+		server.unfullscreenView(view)
+		return
+	}
+
+	out := server.viewOutput(view)
+	if out == nil {
+		return
+	}
+	server.fullscreenView(view, out)
+}
+
+// fullscreenView makes view cover the whole of out, including the
+// status bar, and stacks it above everything else on that output.
+func (server *Server) fullscreenView(view *View, out *Output) {
+	if !view.Mapped() {
+		return
+	}
+
+	if prev := server.fullscreenViewOn(out); prev != nil {
+		server.unfullscreenView(prev)
+	}
+
+	view.fullscreenTiled = server.isViewTiled(view)
+	if view.fullscreenTiled {
+		server.untileView(view, false)
+	}
+	view.fullscreenRestore = view.Bounds()
+	view.Fullscreen = out
+
+	// The bindings don't expose the fullscreen state of either kind
+	// of surface, so maximized is the closest that can be sent.
+	view.SetMaximized(true)
+	server.resizeViewTo(out, view, server.outputBounds(out))
+	server.focusView(view, view.Surface())
+
+	server.emitView(ipc.EventViewFullscreen, view)
+}
+
+func (server *Server) unfullscreenView(view *View) {
+	view.Fullscreen = nil
+	view.SetMaximized(false)
+
+	if view.fullscreenTiled {
+		// tileView overwrites Restore with the current bounds, which
+		// are those of the output at this point.
+		restore := view.Restore
+		server.tileView(view)
+		view.Restore = restore
+	} else {
+		server.resizeViewTo(nil, view, view.fullscreenRestore)
+	}
+
+	server.emitView(ipc.EventViewUnfullscreen, view)
+}
+
+// fullscreenViewOn returns the view that is fullscreen on out, if
+// there is one.
+func (server *Server) fullscreenViewOn(out *Output) *View {
+	if out == nil {
+		return nil
+	}
+
+	for _, view := range server.views {
+		if view.Fullscreen == out {
+			return view
+		}
+	}
+	return nil
+}
+
 func (server *Server) isViewTiled(view *View) bool {
 	return slices.Contains(server.tiled, view)
 }
 
+func (server *Server) isViewHidden(view *View) bool {
+	return slices.Contains(server.hidden, view)
+}
+
+// isViewShown reports whether view is on the current workspace. Views
+// that are hidden or on another workspace aren't.
+func (server *Server) isViewShown(view *View) bool {
+	return server.workspaceOf(view) == server.workspace
+}
+
 func (server *Server) closeView(view *View) {
 	view.Close()
 }
@@ -577,17 +970,12 @@ func (server *Server) onNewToplevelDecoration(dm wlr.XDGDecorationManagerV1, d w
 }
 
 func (server *Server) updateTitles() {
-	// Not the best way to do this, perhaps...
-	for _, view := range server.hidden {
-		item := server.mainMenu.Item(len(mainMenuText))
-		item.Release()
-
-		n := NewTextMenuItem(server.renderer, view.Title())
-		n.OnSelect = item.OnSelect
-
-		server.mainMenu.Remove(item)
-		item.Release()
-		server.mainMenu.Add(n)
+	for _, view := range slices.Concat(server.views, server.tiled, server.otherWorkspaceViews(), server.hidden) {
+		title := view.Title()
+		if title != view.title {
+			view.title = title
+			server.emitView(ipc.EventViewTitle, view)
+		}
 	}
 
 	var focusedTitle string
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"deedles.dev/kawa/internal/ipc"
+	"deedles.dev/wlr"
+)
+
+// NumWorkspaces is the number of workspaces. They are numbered from 1
+// in the UI, but indexed from 0 everywhere else.
+const NumWorkspaces = 9
+
+// Workspace holds the views of a workspace that isn't currently
+// shown. The views of the current workspace live in server.views and
+// server.tiled instead so that the rest of the server doesn't need to
+// know about workspaces at all.
+type Workspace struct {
+	views   []*View
+	tiled   []*View
+	focused *View
+}
+
+func init() {
+	for i := range NumWorkspaces {
+		actions[fmt.Sprintf("workspace-%v", i+1)] = func(server *Server) {
+			server.switchWorkspace(i)
+		}
+		actions[fmt.Sprintf("send-to-workspace-%v", i+1)] = func(server *Server) {
+			server.actionSendToWorkspace(i)
+		}
+	}
+}
+
+// switchWorkspace makes workspace n the current one.
+func (server *Server) switchWorkspace(n int) {
+	if (n == server.workspace) || (n < 0) || (n >= NumWorkspaces) {
+		return
+	}
+
+	server.startNormal()
+
+	cur := &server.workspaces[server.workspace]
+	cur.views, cur.tiled, cur.focused = server.views, server.tiled, server.focusedView()
+	for _, view := range slices.Concat(cur.views, cur.tiled) {
+		view.SetActivated(false)
+	}
+
+	next := &server.workspaces[n]
+	server.views, server.tiled = next.views, next.tiled
+	focused := next.focused
+	*next = Workspace{}
+	server.workspace = n
+
+	server.clearFocus()
+	if (focused != nil) && focused.Mapped() {
+		server.focusView(focused, focused.Surface())
+	}
+	server.layoutTiles(nil)
+	server.updateWorkspace()
+	server.updateTitles()
+
+	// Pointer focus needs to move off of views that are no longer
+	// visible.
+	if m, ok := server.inputMode.(CursorMover); ok {
+		m.CursorMoved(server, time.Now())
+	}
+
+	server.emit(ipc.Event{Type: ipc.EventWorkspace, Workspace: server.workspace + 1})
+}
+
+// sendToWorkspace moves view from the current workspace to workspace
+// n. Tiled views stay tiled.
+func (server *Server) sendToWorkspace(view *View, n int) {
+	if (n == server.workspace) || (n < 0) || (n >= NumWorkspaces) {
+		return
+	}
+	if server.workspaceOf(view) != server.workspace {
+		return
+	}
+
+	if view.Fullscreen != nil {
+		server.unfullscreenView(view)
+	}
+
+	focused := server.focusedView() == view
+	view.SetActivated(false)
+
+	ws := &server.workspaces[n]
+	if i := slices.Index(server.tiled, view); i >= 0 {
+		server.removeTileWeight(server.workspace, server.tiled, view)
+		server.tiled = slices.Delete(server.tiled, i, i+1)
+		ws.tiled = append(ws.tiled, view)
+		server.layoutTiles(view.TiledOn)
+	} else {
+		i := slices.Index(server.views, view)
+		server.views = slices.Delete(server.views, i, i+1)
+		ws.views = append(ws.views, view)
+	}
+
+	if focused {
+		server.clearFocus()
+		if n, ok := server.topView(); ok {
+			server.focusView(n, n.Surface())
+		}
+	}
+	server.updateTitles()
+
+	server.emitView(ipc.EventViewWorkspace, view)
+}
+
+// workspaceOf returns the index of the workspace that view is on, or
+// -1 if it is hidden.
+func (server *Server) workspaceOf(view *View) int {
+	if slices.Contains(server.views, view) || slices.Contains(server.tiled, view) {
+		return server.workspace
+	}
+	for i, ws := range server.workspaces {
+		if slices.Contains(ws.views, view) || slices.Contains(ws.tiled, view) {
+			return i
+		}
+	}
+	return -1
+}
+
+// removeFromWorkspaces removes view from any workspace that isn't the
+// current one.
+func (server *Server) removeFromWorkspaces(view *View) {
+	for i := range server.workspaces {
+		ws := &server.workspaces[i]
+		server.removeTileWeight(i, ws.tiled, view)
+		ws.views = slices.DeleteFunc(ws.views, func(v *View) bool { return v == view })
+		ws.tiled = slices.DeleteFunc(ws.tiled, func(v *View) bool { return v == view })
+		if ws.focused == view {
+			ws.focused = nil
+		}
+	}
+}
+
+// otherWorkspaceViews returns the views on workspaces other than the
+// current one.
+func (server *Server) otherWorkspaceViews() []*View {
+	var views []*View
+	for _, ws := range server.workspaces {
+		views = append(views, ws.tiled...)
+		views = append(views, ws.views...)
+	}
+	return views
+}
+
+// clearFocus removes keyboard focus from all surfaces.
+func (server *Server) clearFocus() {
+	if fv := server.focusedView(); fv != nil {
+		fv.SetActivated(false)
+	}
+
+	k := server.seat.GetKeyboard()
+	server.seat.KeyboardNotifyEnter(wlr.Surface{}, nil, k.Modifiers())
+}
+
+func (server *Server) updateWorkspace() {
+	server.statusBar.SetWorkspace(server.renderer, strconv.Itoa(server.workspace+1))
+}
+
+func (server *Server) actionSendToWorkspace(n int) {
+	server.withFocusedView(func(view *View) {
+		server.sendToWorkspace(view, n)
+		server.startNormal()
+	})
+}
+
+func (server *Server) actionNextWorkspace() {
+	server.switchWorkspace((server.workspace + 1) % NumWorkspaces)
+}
+
+func (server *Server) actionPrevWorkspace() {
+	server.switchWorkspace((server.workspace + NumWorkspaces - 1) % NumWorkspaces)
+}
+
+func (server *Server) actionSendToNextWorkspace() {
+	server.actionSendToWorkspace((server.workspace + 1) % NumWorkspaces)
+}
+
+func (server *Server) actionSendToPrevWorkspace() {
+	server.actionSendToWorkspace((server.workspace + NumWorkspaces - 1) % NumWorkspaces)
+}